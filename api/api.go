@@ -2,12 +2,14 @@ package api
 
 import (
     "bing/utils"
+    "context"
     "encoding/json"
     "fmt"
     "log"
     "net/http"
     "net/url"
-    "sync"
+    "strconv"
+    "strings"
 )
 
 const DefaultURL = "https://api.cognitive.microsoft.com/bing/v7.0/images/search"
@@ -23,17 +25,60 @@ type SearchParams struct {
     License string		`json:"license,omitempty"`
     Size string			`json:"size,omitempty"`
 }
+// AsQueryParameters encodes params into a canonical query string: parameters
+// are sorted by name, and empty strings and disabled safe search are omitted,
+// so equal params always produce the same string.
 func (p SearchParams) AsQueryParameters() string {
-    data, err := json.Marshal(p)
-    if err != nil { panic(err) }
-    var jsonObject map[string]interface{}
-    _ = json.Unmarshal(data, &jsonObject)
-    values := make(url.Values)
-    for k, v := range jsonObject {
-        if v == "" { continue }
-        values.Add(k, fmt.Sprintf("%v", v))
+    safeSearch := ""
+    if p.SafeSearch { safeSearch = "true" }
+    // sorted by name
+    pairs := []struct { name, value string }{
+        {"color", p.Color},
+        {"count", strconv.Itoa(p.Count)},
+        {"freshness", p.Freshness},
+        {"imageType", p.ImageType},
+        {"license", p.License},
+        {"offset", strconv.Itoa(p.Offset)},
+        {"q", p.Query},
+        {"safeSearch", safeSearch},
+        {"size", p.Size},
+    }
+    encoded := make([]string, 0, len(pairs))
+    for _, pair := range pairs {
+        if pair.value == "" && pair.name != "q" { continue }
+        encoded = append(encoded, url.QueryEscape(pair.name) + "=" + url.QueryEscape(pair.value))
     }
-    return values.Encode()
+    return strings.Join(encoded, "&")
+}
+
+// ParseSearchParams is the inverse of SearchParams.AsQueryParameters.
+func ParseSearchParams(query string) (SearchParams, error) {
+    values, err := url.ParseQuery(query)
+    if err != nil { return SearchParams{}, err }
+
+    var p SearchParams
+    for name, items := range values {
+        if len(items) != 1 {
+            return SearchParams{}, fmt.Errorf("parameter %s is repeated %d times", name, len(items))
+        }
+        value := items[0]
+        switch name {
+        case "count": p.Count, err = strconv.Atoi(value)
+        case "offset": p.Offset, err = strconv.Atoi(value)
+        case "q": p.Query = value
+        case "safeSearch": p.SafeSearch, err = strconv.ParseBool(value)
+        case "color": p.Color = value
+        case "freshness": p.Freshness = value
+        case "imageType": p.ImageType = value
+        case "license": p.License = value
+        case "size": p.Size = value
+        default: return SearchParams{}, fmt.Errorf("unknown search parameter: %s", name)
+        }
+        if err != nil {
+            return SearchParams{}, fmt.Errorf("invalid value of parameter %s: %s", name, err)
+        }
+    }
+    return p, nil
 }
 
 type ImageResult struct {
@@ -45,13 +90,16 @@ type ImageResult struct {
     ImageID string		  `json:"imageId"`
     Name string			  `json:"name"`
     WebSearchURL string   `json:"webSearchUrl"`
+    HostPageURL string    `json:"hostPageUrl"`
     ContentURL string     `json:"contentUrl"`
 }
 
 type ImagesCollection struct {
     NextOffset int  	 `json:"nextOffset"`
     Values []ImageResult `json:"value"`
-    Query string
+    Query string         `json:"query"`
+    // Offset is the offset of the page's first result.
+    Offset int           `json:"offset"`
 }
 
 var DefaultSearchParams = SearchParams{
@@ -76,10 +124,35 @@ func CreateQuery(query string, offset int) SearchParams {
 type BingClient struct {
     Endpoint string
     SecretKey string
+    HTTPClient *http.Client
+    Cache *ResponseCache
+    // Keys, if set, replaces Endpoint and SecretKey with a pool of credentials.
+    Keys *KeyPool
+    // Usage, if set, counts transactions and refuses requests beyond the budget.
+    Usage *UsageTracker
+    Retry RetryPolicy
+    Limiter *RateLimiter
 }
 
 func NewBingClient(endpoint, key string) *BingClient {
-    return &BingClient{Endpoint:endpoint, SecretKey:key}
+    return &BingClient{Endpoint:endpoint, SecretKey:key, HTTPClient:http.DefaultClient}
+}
+
+// NewBingClientPool creates a client rotating among credentials of the pool.
+func NewBingClientPool(keys *KeyPool) *BingClient {
+    return &BingClient{HTTPClient:http.DefaultClient, Keys:keys}
+}
+
+// Name describes the client in logs.
+func (c *BingClient) Name() string {
+    if c.Keys != nil { return fmt.Sprintf("bing:pool of %d keys", c.Keys.Len()) }
+    return "bing:" + c.Endpoint
+}
+
+// UseCassette routes all client's requests through the cassette to record or
+// replay them.
+func (c *BingClient) UseCassette(cassette *Cassette) {
+    c.HTTPClient = &http.Client{Transport:cassette}
 }
 
 func (c *BingClient) Pull(queries []string, start int, downloadAll bool) (result []*ImagesCollection) {
@@ -105,83 +178,90 @@ func (c *BingClient) Pull(queries []string, start int, downloadAll bool) (result
     return result
 }
 
-func (c *BingClient) PullParallel(queries []string, start int, downloadAll bool) (collections []*ImagesCollection) {
-    type result struct {
-        collection *ImagesCollection
-        err error
+// RequestImages sends a single search request. Responses with an error status
+// are logged and returned as collections without values; transport failures panic.
+func (c *BingClient) RequestImages(params SearchParams) *ImagesCollection {
+    result, err := c.RequestPage(context.Background(), params)
+    if apiErr, ok := err.(*APIError); ok {
+        log.Printf("query '%s' failed: %s", params.Query, apiErr)
+        return &ImagesCollection{Query:params.Query}
     }
+    if err != nil { panic(err) }
+    return result
+}
 
-    results := make(chan result)
-    var wg sync.WaitGroup
-    log.Printf("start running queries")
-
-    for i, query := range queries {
-        log.Printf("submitting query %d of %d", i, len(queries))
-
-        if query == "" { continue }
-
-        log.Printf("search string: %s", query)
-
-        wg.Add(1)
-        go func(q string, output chan<- result) {
-            defer wg.Done()
-            currOffset := start
-            running := true
-            var err error
-            for running {
-                params := CreateQuery(q, currOffset)
-                paramsString := params.AsQueryParameters()
-                log.Printf("running query with params: %s", paramsString)
-                images := c.RequestImages(params)
-                if images.Values == nil {
-                    err = fmt.Errorf("failed to pull query: %s/%s", c.Endpoint, paramsString)
-                    running = false
-                } else if downloadAll {
-                    running = images.NextOffset != currOffset
-                    currOffset = images.NextOffset
-                } else {
-                    running = false
-                }
-                output <- result{images, err}
-            }
-        }(query, results)
+// RequestPage sends a single search request and returns one page of results,
+// or an *APIError if the API responds with an error status.
+func (c *BingClient) RequestPage(ctx context.Context, params SearchParams) (*ImagesCollection, error) {
+    if c.Cache != nil {
+        if cached, ok := c.Cache.Get(params); ok {
+            log.Printf("serving query from cache: %s", params.AsQueryParameters())
+            return cached, nil
+        }
     }
 
-    go func(){
-        wg.Wait()
-    }()
-
-    log.Printf("combining the collected results")
-
-    for result := range results {
-        if result.err != nil {
-            log.Printf(result.err.Error())
+    var result *ImagesCollection
+    err := c.Retry.Do(ctx, func() (err error) {
+        if c.Limiter != nil {
+            if err = c.Limiter.Wait(ctx); err != nil { return err }
+        }
+        if c.Keys != nil {
+            result, err = c.sendWithPool(ctx, params)
         } else {
-            collections = append(collections, result.collection)
+            result, err = c.send(ctx, c.Endpoint, c.SecretKey, params)
         }
-    }
+        return err
+    })
+    if err != nil { return nil, err }
 
-    return collections
+    result.Query = params.Query
+    result.Offset = params.Offset
+    if c.Cache != nil && result.Values != nil {
+        if err = c.Cache.Put(params, result); err != nil {
+            log.Printf("cannot cache response: %s", err)
+        }
+    }
+    return result, nil
 }
 
-func (c *BingClient) RequestImages(params SearchParams) *ImagesCollection {
-    request := c.MakeRequest("GET", params)
-    request.Header.Add("Ocp-Apim-Subscription-Key", c.SecretKey)
-    response, err := http.DefaultClient.Do(request)
-    if err != nil { panic(err) }
+// send requests a page from endpoint authorized with key. A transaction is
+// counted unless the request failed before a successful response, which is the
+// only one billed, came back.
+func (c *BingClient) send(ctx context.Context, endpoint, key string, params SearchParams) (result *ImagesCollection, err error) {
+    billed := false
+    if c.Usage != nil {
+        if err = c.Usage.Reserve(key); err != nil { return nil, err }
+        defer func() {
+            if !billed { c.Usage.Release(key) }
+            if saveErr := c.Usage.Save(); saveErr != nil {
+                log.Printf("cannot save API usage: %s", saveErr)
+            }
+        }()
+    }
+
+    request := newRequest("GET", endpoint, params).WithContext(ctx)
+    request.Header.Add("Ocp-Apim-Subscription-Key", key)
+    response, err := c.HTTPClient.Do(request)
+    if err != nil { return nil, err }
 
     defer utils.SilentClose(response.Body)
-    result := ImagesCollection{}
-    decoder := json.NewDecoder(response.Body)
-    err = decoder.Decode(&result)
-    if err != nil { panic(err) }
+    if response.StatusCode != http.StatusOK {
+        return nil, newAPIError(response)
+    }
+    billed = true
 
-    result.Query = params.Query
-    return &result
+    result = &ImagesCollection{}
+    decoder := json.NewDecoder(response.Body)
+    if err = decoder.Decode(result); err != nil { return nil, fmt.Errorf("%w: %s", ErrInvalidResponse, err) }
+    return result, nil
 }
 
 func (c *BingClient) MakeRequest(method string, params SearchParams) *http.Request {
-    request, err := http.NewRequest(method, c.Endpoint, nil)
+    return newRequest(method, c.Endpoint, params)
+}
+
+func newRequest(method, endpoint string, params SearchParams) *http.Request {
+    request, err := http.NewRequest(method, endpoint, nil)
     if err != nil { panic(err) }
     query := params.AsQueryParameters()
     request.URL.RawQuery = query
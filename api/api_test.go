@@ -0,0 +1,44 @@
+package api
+
+import "testing"
+
+func TestAsQueryParameters(t *testing.T) {
+    tests := []struct {
+        params SearchParams
+        expected string
+    }{
+        {SearchParams{Count:10, Query:"cats"}, "count=10&offset=0&q=cats"},
+        {SearchParams{Count:10, Offset:20, Query:"red cats & dogs"}, "count=10&offset=20&q=red+cats+%26+dogs"},
+        {SearchParams{Count:150, Query:"cats", SafeSearch:true, Color:"ColorOnly", ImageType:"Photo", License:"Any", Size:"Large"},
+            "color=ColorOnly&count=150&imageType=Photo&license=Any&offset=0&q=cats&safeSearch=true&size=Large"},
+        {SearchParams{Count:1, Freshness:"Week"}, "count=1&freshness=Week&offset=0&q="},
+    }
+    for _, test := range tests {
+        if encoded := test.params.AsQueryParameters(); encoded != test.expected {
+            t.Errorf("%+v: expected %q, got %q", test.params, test.expected, encoded)
+        }
+    }
+}
+
+func TestParseSearchParams(t *testing.T) {
+    tests := []SearchParams{
+        {Count:35, Query:"cats"},
+        {Count:150, Offset:300, Query:"big \"red\" cats", SafeSearch:true},
+        {Count:10, Query:"ünïcode/?#", Color:"Monochrome", Freshness:"Month", ImageType:"Clipart", License:"Public", Size:"Small"},
+    }
+    for _, params := range tests {
+        parsed, err := ParseSearchParams(params.AsQueryParameters())
+        if err != nil {
+            t.Errorf("%+v: unexpected error: %s", params, err)
+        } else if parsed != params {
+            t.Errorf("expected %+v, got %+v", params, parsed)
+        }
+    }
+
+    invalid := []string{"count=x", "q=a&q=b", "page=2", "safeSearch=maybe"}
+    for _, query := range invalid {
+        if _, err := ParseSearchParams(query); err == nil {
+            t.Errorf("%q: expected an error", query)
+        }
+    }
+}
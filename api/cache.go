@@ -0,0 +1,62 @@
+package api
+
+import (
+    "bing/utils"
+    "crypto/sha1"
+    "encoding/hex"
+    "encoding/json"
+    "io/ioutil"
+    "os"
+    "path"
+    "strings"
+    "time"
+)
+
+// ResponseCache keeps search responses on disk so repeated or overlapping
+// queries are served without sending them to the API again. Entries older than
+// TTL are ignored; zero TTL means the entries never expire.
+type ResponseCache struct {
+    Folder string
+    TTL time.Duration
+}
+
+func NewResponseCache(folder string, ttl time.Duration) (*ResponseCache, error) {
+    if err := os.MkdirAll(folder, os.ModePerm); err != nil { return nil, err }
+    return &ResponseCache{Folder:folder, TTL:ttl}, nil
+}
+
+// Key identifies params in cache. The search string is compared ignoring case
+// and extra whitespace, and the rest of the parameters are encoded with sorted
+// names, so equivalent queries share the same entry.
+func (c *ResponseCache) Key(params SearchParams) string {
+    params.Query = strings.ToLower(strings.Join(strings.Fields(params.Query), " "))
+    digest := sha1.Sum([]byte(params.AsQueryParameters()))
+    return hex.EncodeToString(digest[:])
+}
+
+// Get returns the cached response for params, if there is a fresh one.
+func (c *ResponseCache) Get(params SearchParams) (*ImagesCollection, bool) {
+    fileName := c.fileFor(params)
+    info, err := os.Stat(fileName)
+    if err != nil { return nil, false }
+    if c.TTL > 0 && time.Since(info.ModTime()) > c.TTL { return nil, false }
+
+    data, err := ioutil.ReadFile(fileName)
+    if err != nil { return nil, false }
+    var collection ImagesCollection
+    if err = json.Unmarshal(data, &collection); err != nil { return nil, false }
+    collection.Query = params.Query
+    collection.Offset = params.Offset
+    return &collection, true
+}
+
+// Put stores the response for params.
+func (c *ResponseCache) Put(params SearchParams, collection *ImagesCollection) error {
+    data, err := json.Marshal(collection)
+    if err != nil { return err }
+    return utils.WriteFileAtomic(c.fileFor(params), data)
+}
+
+func (c *ResponseCache) fileFor(params SearchParams) string {
+    return path.Join(c.Folder, c.Key(params) + ".json")
+}
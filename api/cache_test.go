@@ -0,0 +1,77 @@
+package api_test
+
+import (
+    "bing/api"
+    "bing/mockbing"
+    "context"
+    "os"
+    "path"
+    "testing"
+    "time"
+)
+
+func TestResponseCacheKey(t *testing.T) {
+    cache := &api.ResponseCache{}
+    tests := []struct {
+        a, b api.SearchParams
+        same bool
+    }{
+        {api.CreateQuery("cats", 0), api.CreateQuery("Cats", 0), true},
+        {api.CreateQuery("red cats", 0), api.CreateQuery("  RED   cats ", 0), true},
+        {api.CreateQuery("red cats", 0), api.CreateQuery("redcats", 0), false},
+        {api.CreateQuery("cats", 0), api.CreateQuery("cats", 150), false},
+        {api.CreateQuery("cats", 0), api.SearchParams{Query:"cats", Count:10}, false},
+    }
+    for _, test := range tests {
+        if same := cache.Key(test.a) == cache.Key(test.b); same != test.same {
+            t.Errorf("%q and %q: expected same key to be %v", test.a.Query, test.b.Query, test.same)
+        }
+    }
+}
+
+func TestResponseCache(t *testing.T) {
+    tests := []struct {
+        name string
+        ttl time.Duration
+        age time.Duration
+        query string
+        requests int
+    }{
+        {name:"hit", ttl:time.Hour, query:"cats", requests:1},
+        {name:"normalized hit", ttl:time.Hour, query:" CATS ", requests:1},
+        {name:"miss", ttl:time.Hour, query:"dogs", requests:2},
+        {name:"expired", ttl:time.Hour, age:2 * time.Hour, query:"cats", requests:2},
+        {name:"fresh", ttl:time.Hour, age:time.Minute, query:"cats", requests:1},
+        {name:"never expires", age:1000 * time.Hour, query:"cats", requests:1},
+    }
+    for _, test := range tests {
+        mock := mockbing.NewServer(nil, mockbing.Options{Synthetic:5})
+        server := mock.Start()
+        cache, err := api.NewResponseCache(t.TempDir(), test.ttl)
+        if err != nil { t.Fatal(err) }
+        client := api.NewBingClient(mockbing.Endpoint(server.URL), "secret")
+        client.Cache = cache
+
+        first, err := client.RequestPage(context.Background(), api.CreateQuery("cats", 0))
+        if err != nil { t.Fatalf("%s: %s", test.name, err) }
+        if test.age > 0 {
+            modified := time.Now().Add(-test.age)
+            entry := path.Join(cache.Folder, cache.Key(api.CreateQuery("cats", 0)) + ".json")
+            if err = os.Chtimes(entry, modified, modified); err != nil { t.Fatalf("%s: %s", test.name, err) }
+        }
+        second, err := client.RequestPage(context.Background(), api.CreateQuery(test.query, 0))
+        requests := mock.Requests()
+        server.Close()
+
+        if err != nil { t.Fatalf("%s: %s", test.name, err) }
+        if requests != test.requests {
+            t.Errorf("%s: expected %d requests, got %d", test.name, test.requests, requests)
+        }
+        if second.Query != test.query {
+            t.Errorf("%s: expected cached page to have query %q, got %q", test.name, test.query, second.Query)
+        }
+        if test.requests == 1 && second.Values[0] != first.Values[0] {
+            t.Errorf("%s: expected cached results, got %+v", test.name, second.Values[0])
+        }
+    }
+}
@@ -0,0 +1,115 @@
+package api
+
+import (
+    "bing/utils"
+    "bytes"
+    "crypto/sha1"
+    "encoding/hex"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io/ioutil"
+    "net/http"
+    "os"
+    "path"
+)
+
+type CassetteMode int
+
+// ErrNotRecorded is returned when a replayed request is missing in the cassette.
+var ErrNotRecorded = errors.New("no recorded response")
+
+const (
+    // Record sends requests to the API and stores every response into cassette.
+    Record CassetteMode = iota
+    // Replay serves responses from cassette without touching the network.
+    Replay
+)
+
+// Cassette is a transport that records HTTP interactions into a folder, one file
+// per request, or replays them back. Subscription keys are never stored.
+type Cassette struct {
+    Folder string
+    Mode CassetteMode
+    Transport http.RoundTripper
+}
+
+// episode is a single recorded request/response pair.
+type episode struct {
+    Method string       `json:"method"`
+    URL string          `json:"url"`
+    Status int          `json:"status"`
+    Header http.Header  `json:"header"`
+    Body string         `json:"body"`
+}
+
+func NewCassette(folder string, mode CassetteMode) (*Cassette, error) {
+    if mode == Record {
+        if err := os.MkdirAll(folder, os.ModePerm); err != nil { return nil, err }
+    } else if _, err := os.Stat(folder); err != nil {
+        return nil, err
+    }
+    return &Cassette{Folder:folder, Mode:mode, Transport:http.DefaultTransport}, nil
+}
+
+func (c *Cassette) RoundTrip(request *http.Request) (*http.Response, error) {
+    if c.Mode == Replay {
+        return c.replay(request)
+    }
+    return c.record(request)
+}
+
+func (c *Cassette) record(request *http.Request) (*http.Response, error) {
+    response, err := c.Transport.RoundTrip(request)
+    if err != nil { return nil, err }
+
+    body, err := ioutil.ReadAll(response.Body)
+    _ = response.Body.Close()
+    if err != nil { return nil, err }
+
+    recorded := episode{
+        Method: request.Method,
+        URL: request.URL.String(),
+        Status: response.StatusCode,
+        Header: response.Header,
+        Body: string(body),
+    }
+    data, err := json.MarshalIndent(recorded, "", " ")
+    if err != nil { return nil, err }
+    if err = utils.WriteFileAtomic(c.fileFor(request), data); err != nil { return nil, err }
+
+    response.Body = ioutil.NopCloser(bytes.NewReader(body))
+    return response, nil
+}
+
+func (c *Cassette) replay(request *http.Request) (*http.Response, error) {
+    data, err := ioutil.ReadFile(c.fileFor(request))
+    if os.IsNotExist(err) {
+        return nil, fmt.Errorf("cassette %s: %w for %s %s",
+            c.Folder, ErrNotRecorded, request.Method, request.URL)
+    } else if err != nil {
+        return nil, err
+    }
+
+    var recorded episode
+    if err = json.Unmarshal(data, &recorded); err != nil { return nil, err }
+
+    return &http.Response{
+        Status: fmt.Sprintf("%d %s", recorded.Status, http.StatusText(recorded.Status)),
+        StatusCode: recorded.Status,
+        Proto: "HTTP/1.1",
+        ProtoMajor: 1,
+        ProtoMinor: 1,
+        Header: recorded.Header,
+        Body: ioutil.NopCloser(bytes.NewReader([]byte(recorded.Body))),
+        ContentLength: int64(len(recorded.Body)),
+        Request: request,
+    }, nil
+}
+
+// fileFor names the cassette file after the request method and URL, so the same
+// query hits the same file regardless of the key it was sent with.
+func (c *Cassette) fileFor(request *http.Request) string {
+    digest := sha1.Sum([]byte(request.Method + " " + request.URL.String()))
+    return path.Join(c.Folder, hex.EncodeToString(digest[:]) + ".json")
+}
@@ -0,0 +1,69 @@
+package api_test
+
+import (
+    "bing/api"
+    "bing/mockbing"
+    "context"
+    "errors"
+    "io/ioutil"
+    "path"
+    "reflect"
+    "strings"
+    "testing"
+)
+
+func TestCassetteReplay(t *testing.T) {
+    folder := t.TempDir()
+    queries := []api.SearchParams{api.CreateQuery("cats", 0), api.CreateQuery("cats", 3), api.CreateQuery("red dogs", 0)}
+
+    server := mockbing.NewServer(nil, mockbing.Options{Key:"secret", Synthetic:5}).Start()
+    recording, err := api.NewCassette(folder, api.Record)
+    if err != nil { t.Fatal(err) }
+    client := api.NewBingClient(mockbing.Endpoint(server.URL), "secret")
+    client.UseCassette(recording)
+    recorded := make([]*api.ImagesCollection, len(queries))
+    for i, params := range queries {
+        if recorded[i], err = client.RequestPage(context.Background(), params); err != nil { t.Fatal(err) }
+    }
+    server.Close()
+
+    files, err := ioutil.ReadDir(folder)
+    if err != nil { t.Fatal(err) }
+    if len(files) != len(queries) { t.Errorf("expected %d recorded files, got %d", len(queries), len(files)) }
+    for _, file := range files {
+        data, err := ioutil.ReadFile(path.Join(folder, file.Name()))
+        if err != nil { t.Fatal(err) }
+        if strings.Contains(string(data), "secret") { t.Errorf("%s keeps the subscription key", file.Name()) }
+    }
+
+    // the server is gone, so the responses can come from the cassette only
+    replaying, err := api.NewCassette(folder, api.Replay)
+    if err != nil { t.Fatal(err) }
+    client = api.NewBingClient(mockbing.Endpoint(server.URL), "")
+    client.UseCassette(replaying)
+
+    tests := []struct {
+        params api.SearchParams
+        expected *api.ImagesCollection
+    }{
+        {queries[0], recorded[0]},
+        {queries[1], recorded[1]},
+        {queries[2], recorded[2]},
+        {api.CreateQuery("birds", 0), nil},
+        {api.CreateQuery("cats", 150), nil},
+    }
+    for _, test := range tests {
+        replayed, err := client.RequestPage(context.Background(), test.params)
+        if test.expected == nil {
+            if !errors.Is(err, api.ErrNotRecorded) {
+                t.Errorf("%s: expected %s, got %v", test.params.AsQueryParameters(), api.ErrNotRecorded, err)
+            }
+            continue
+        }
+        if err != nil {
+            t.Errorf("%s: unexpected error: %s", test.params.AsQueryParameters(), err)
+        } else if !reflect.DeepEqual(replayed, test.expected) {
+            t.Errorf("%s: expected %+v, got %+v", test.params.AsQueryParameters(), test.expected, replayed)
+        }
+    }
+}
@@ -0,0 +1,93 @@
+package api
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io/ioutil"
+    "net/http"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// ErrInvalidResponse is returned when a response cannot be read as search results.
+var ErrInvalidResponse = errors.New("invalid search response")
+
+// APIError is returned when the search endpoint responds with an error status.
+type APIError struct {
+    StatusCode int
+    Code string
+    Message string
+    // RetryAfter is the delay the API asked to wait before the next request.
+    RetryAfter time.Duration
+}
+
+func (e *APIError) Error() string {
+    if e.Message == "" {
+        return fmt.Sprintf("API responded with status %d", e.StatusCode)
+    }
+    return fmt.Sprintf("API responded with status %d: %s (%s)", e.StatusCode, e.Message, e.Code)
+}
+
+// newAPIError reads Bing error response; both v7 'errors' list and Azure
+// gateway 'error' object are understood.
+func newAPIError(response *http.Response) *APIError {
+    apiErr := &APIError{StatusCode:response.StatusCode}
+    if seconds, err := strconv.Atoi(response.Header.Get("Retry-After")); err == nil {
+        apiErr.RetryAfter = time.Duration(seconds) * time.Second
+    }
+    data, err := ioutil.ReadAll(response.Body)
+    if err != nil { return apiErr }
+
+    var body struct {
+        Errors []struct {
+            Code string    `json:"code"`
+            Message string `json:"message"`
+        } `json:"errors"`
+        Error struct {
+            Code string    `json:"code"`
+            Message string `json:"message"`
+        } `json:"error"`
+    }
+    if json.Unmarshal(data, &body) == nil {
+        if len(body.Errors) > 0 {
+            apiErr.Code, apiErr.Message = body.Errors[0].Code, body.Errors[0].Message
+        } else {
+            apiErr.Code, apiErr.Message = body.Error.Code, body.Error.Message
+        }
+    }
+    return apiErr
+}
+
+// QueryError binds an error to the search string which caused it.
+type QueryError struct {
+    Query string
+    Err error
+}
+
+func (e QueryError) Error() string {
+    return fmt.Sprintf("query '%s': %s", e.Query, e.Err)
+}
+
+func (e QueryError) Unwrap() error { return e.Err }
+
+// QueryErrors aggregates failures of several queries.
+type QueryErrors []QueryError
+
+func (e QueryErrors) Error() string {
+    messages := make([]string, len(e))
+    for i, err := range e {
+        messages[i] = err.Error()
+    }
+    return fmt.Sprintf("%d queries failed: %s", len(e), strings.Join(messages, "; "))
+}
+
+// Is tells if any of the queries failed with target, so errors.Is finds
+// ErrNotRecorded or ErrBudgetExceeded among them.
+func (e QueryErrors) Is(target error) bool {
+    for _, err := range e {
+        if errors.Is(err, target) { return true }
+    }
+    return false
+}
@@ -0,0 +1,161 @@
+package api
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "io/ioutil"
+    "net/http"
+    "os"
+    "strconv"
+    "strings"
+)
+
+// FieldMapping tells where to find the results in a JSON response. Each value
+// is a dot-separated path, e.g. "data.items" or "image.thumbnail.url"; Results
+// is resolved from the response root, and the rest of the paths from each item.
+type FieldMapping struct {
+    Results string     `json:"results"`
+    ContentURL string  `json:"contentUrl"`
+    HostPageURL string `json:"hostPageUrl,omitempty"`
+    Name string        `json:"name,omitempty"`
+    Width string       `json:"width,omitempty"`
+    Height string      `json:"height,omitempty"`
+    Format string      `json:"format,omitempty"`
+    ImageID string     `json:"imageId,omitempty"`
+}
+
+// JSONEndpointConfig describes a search API which accepts the query in URL
+// parameters and responds with JSON. Header values can refer to environment
+// variables as ${NAME}, so the keys are not kept in the config file.
+type JSONEndpointConfig struct {
+    Name string                 `json:"name"`
+    URL string                  `json:"url"`
+    QueryParam string           `json:"queryParam"`
+    CountParam string           `json:"countParam,omitempty"`
+    OffsetParam string          `json:"offsetParam,omitempty"`
+    // PageParam makes the provider send 1-based page numbers instead of offsets;
+    // the offsets of the pages are then multiples of the requested count.
+    PageParam string            `json:"pageParam,omitempty"`
+    MaxCount int                `json:"maxCount,omitempty"`
+    Params map[string]string    `json:"params,omitempty"`
+    Headers map[string]string   `json:"headers,omitempty"`
+    Fields FieldMapping         `json:"fields"`
+}
+
+// JSONEndpoint is a provider for any search API described with JSONEndpointConfig.
+type JSONEndpoint struct {
+    Config JSONEndpointConfig
+    HTTPClient *http.Client
+}
+
+func NewJSONEndpoint(config JSONEndpointConfig) (*JSONEndpoint, error) {
+    if config.URL == "" { return nil, fmt.Errorf("endpoint URL is not specified") }
+    if config.Fields.Results == "" || config.Fields.ContentURL == "" {
+        return nil, fmt.Errorf("results and contentUrl fields must be mapped")
+    }
+    if config.QueryParam == "" { config.QueryParam = "q" }
+    if config.Name == "" { config.Name = config.URL }
+    return &JSONEndpoint{Config:config, HTTPClient:http.DefaultClient}, nil
+}
+
+// LoadJSONEndpoint creates provider from JSON config file.
+func LoadJSONEndpoint(fileName string) (*JSONEndpoint, error) {
+    data, err := ioutil.ReadFile(fileName)
+    if err != nil { return nil, err }
+    var config JSONEndpointConfig
+    if err = json.Unmarshal(data, &config); err != nil {
+        return nil, fmt.Errorf("invalid endpoint config %s: %s", fileName, err)
+    }
+    return NewJSONEndpoint(config)
+}
+
+func (e *JSONEndpoint) Name() string {
+    return "json:" + e.Config.Name
+}
+
+func (e *JSONEndpoint) RequestPage(ctx context.Context, params SearchParams) (*ImagesCollection, error) {
+    conf := e.Config
+    count := params.Count
+    if conf.MaxCount > 0 && (count <= 0 || count > conf.MaxCount) { count = conf.MaxCount }
+
+    request, err := http.NewRequest("GET", conf.URL, nil)
+    if err != nil { return nil, err }
+    query := request.URL.Query()
+    for name, value := range conf.Params {
+        query.Set(name, os.ExpandEnv(value))
+    }
+    query.Set(conf.QueryParam, params.Query)
+    if conf.CountParam != "" { query.Set(conf.CountParam, strconv.Itoa(count)) }
+    first, page := params.Offset, 0
+    if conf.PageParam != "" && count > 0 {
+        page = params.Offset / count + 1
+        first = (page - 1) * count
+        query.Set(conf.PageParam, strconv.Itoa(page))
+    } else if conf.OffsetParam != "" {
+        query.Set(conf.OffsetParam, strconv.Itoa(params.Offset))
+    }
+    request.URL.RawQuery = query.Encode()
+    for name, value := range conf.Headers {
+        request.Header.Set(name, os.ExpandEnv(value))
+    }
+
+    var response interface{}
+    if err = getJSON(e.HTTPClient, request.WithContext(ctx), &response); err != nil { return nil, err }
+
+    items, ok := lookupPath(response, conf.Fields.Results).([]interface{})
+    if !ok { return nil, fmt.Errorf("response has no results list at '%s'", conf.Fields.Results) }
+
+    result := ImagesCollection{Query:params.Query, Offset:first, Values:make([]ImageResult, 0, len(items))}
+    for _, item := range items {
+        image := ImageResult{
+            ContentURL: lookupString(item, conf.Fields.ContentURL),
+            HostPageURL: lookupString(item, conf.Fields.HostPageURL),
+            Name: lookupString(item, conf.Fields.Name),
+            Width: lookupInt(item, conf.Fields.Width),
+            Height: lookupInt(item, conf.Fields.Height),
+            EncodingFormat: lookupString(item, conf.Fields.Format),
+            ImageID: lookupString(item, conf.Fields.ImageID),
+        }
+        if image.ContentURL == "" { continue }
+        if image.EncodingFormat == "" { image.EncodingFormat = formatFromURL(image.ContentURL) }
+        result.Values = append(result.Values, image)
+    }
+
+    result.NextOffset = params.Offset
+    if len(items) > 0 {
+        result.NextOffset = first + len(items)
+        // offsets count whole pages, whatever page size the API uses
+        if page > 0 { result.NextOffset = page * count }
+    }
+    return &result, nil
+}
+
+// lookupPath follows dot-separated path through decoded JSON objects.
+func lookupPath(value interface{}, path string) interface{} {
+    if path == "" { return nil }
+    for _, key := range strings.Split(path, ".") {
+        object, ok := value.(map[string]interface{})
+        if !ok { return nil }
+        value = object[key]
+    }
+    return value
+}
+
+func lookupString(value interface{}, path string) string {
+    switch v := lookupPath(value, path).(type) {
+    case string: return v
+    case float64: return strconv.FormatFloat(v, 'f', -1, 64)
+    default: return ""
+    }
+}
+
+func lookupInt(value interface{}, path string) int {
+    switch v := lookupPath(value, path).(type) {
+    case float64: return int(v)
+    case string:
+        n, _ := strconv.Atoi(v)
+        return n
+    default: return 0
+    }
+}
@@ -0,0 +1,54 @@
+package api
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "net/http/httptest"
+    "strconv"
+    "testing"
+)
+
+func TestJSONEndpointPages(t *testing.T) {
+    tests := []struct {
+        name string
+        pageSize int
+        total int
+        expected int
+    }{
+        {"pages of requested size", 5, 12, 12},
+        {"smaller pages", 3, 10, 10},
+        {"larger pages", 8, 20, 20},
+    }
+    for _, test := range tests {
+        server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+            items := make([]map[string]string, 0)
+            for i := (page - 1) * test.pageSize; i < page * test.pageSize && i < test.total; i++ {
+                items = append(items, map[string]string{"url":fmt.Sprintf("http://x/%d.jpg", i)})
+            }
+            _ = json.NewEncoder(w).Encode(map[string]interface{}{"items":items})
+        }))
+        endpoint, err := NewJSONEndpoint(JSONEndpointConfig{
+            URL: server.URL,
+            PageParam: "page",
+            Fields: FieldMapping{Results:"items", ContentURL:"url"},
+        })
+        if err != nil { t.Fatal(err) }
+
+        seen := make(map[string]bool)
+        offset := 0
+        for requests := 0; requests < 100; requests++ {
+            result, err := endpoint.RequestPage(context.Background(), SearchParams{Query:"cats", Count:5, Offset:offset})
+            if err != nil { t.Fatalf("%s: unexpected error: %s", test.name, err) }
+            for _, image := range result.Values { seen[image.ContentURL] = true }
+            if result.NextOffset == offset { break }
+            offset = result.NextOffset
+        }
+        server.Close()
+        if len(seen) != test.expected {
+            t.Errorf("%s: expected %d images, got %d", test.name, test.expected, len(seen))
+        }
+    }
+}
@@ -0,0 +1,170 @@
+package api
+
+import (
+    "context"
+    "crypto/sha256"
+    "encoding/hex"
+    "fmt"
+    "log"
+    "net/http"
+    "sync"
+    "time"
+)
+
+type RotationStrategy int
+
+const (
+    // RoundRobin spreads requests evenly among all the keys.
+    RoundRobin RotationStrategy = iota
+    // OnFailure keeps using the same key until it is rejected or throttled.
+    OnFailure
+)
+
+// defaultCooldown is how long a throttled key rests if the API didn't say.
+const defaultCooldown = time.Second
+
+// Credential is a subscription key together with the regional endpoint it is
+// issued for.
+type Credential struct {
+    Endpoint string
+    Key string
+}
+
+// KeyUsage reports how a single key of the pool was used.
+type KeyUsage struct {
+    Endpoint string
+    Key string
+    Requests int
+    Rejected int
+    Throttled int
+    Disabled bool
+}
+
+// KeyPool hands out credentials so no single key's quota is exhausted. Keys
+// rejected with 401 or 403 are disabled, and keys throttled with 429 rest until
+// the API allows to retry.
+type KeyPool struct {
+    Strategy RotationStrategy
+
+    mu sync.Mutex
+    credentials []Credential
+    usage []KeyUsage
+    resting []time.Time
+    next int
+}
+
+func NewKeyPool(credentials []Credential, strategy RotationStrategy) (*KeyPool, error) {
+    if len(credentials) == 0 { return nil, fmt.Errorf("key pool needs at least one key") }
+    pool := &KeyPool{
+        Strategy: strategy,
+        credentials: credentials,
+        usage: make([]KeyUsage, len(credentials)),
+        resting: make([]time.Time, len(credentials)),
+    }
+    for i, credential := range credentials {
+        if credential.Key == "" { return nil, fmt.Errorf("key %d of the pool is empty", i) }
+        pool.usage[i] = KeyUsage{Endpoint:credential.Endpoint, Key:MaskKey(credential.Key)}
+    }
+    return pool, nil
+}
+
+func (p *KeyPool) Len() int { return len(p.credentials) }
+
+// Pick returns the index and the credential to use for the next request, or
+// an error if every key is disabled or resting.
+func (p *KeyPool) Pick() (int, Credential, error) {
+    p.mu.Lock()
+    defer p.mu.Unlock()
+    now := time.Now()
+    for attempt := 0; attempt < len(p.credentials); attempt++ {
+        i := (p.next + attempt) % len(p.credentials)
+        if p.usage[i].Disabled || now.Before(p.resting[i]) { continue }
+        p.next = i
+        if p.Strategy == RoundRobin { p.next = (i + 1) % len(p.credentials) }
+        p.usage[i].Requests++
+        return i, p.credentials[i], nil
+    }
+    return 0, Credential{}, fmt.Errorf("all %d keys are disabled or throttled", len(p.credentials))
+}
+
+// Report tells the pool how the request made with the key at index ended.
+func (p *KeyPool) Report(index int, err error) {
+    apiErr, ok := err.(*APIError)
+    if !ok { return }
+
+    p.mu.Lock()
+    defer p.mu.Unlock()
+    switch apiErr.StatusCode {
+    case http.StatusUnauthorized, http.StatusForbidden:
+        p.usage[index].Rejected++
+        p.usage[index].Disabled = true
+    case http.StatusTooManyRequests:
+        p.usage[index].Throttled++
+        cooldown := apiErr.RetryAfter
+        if cooldown <= 0 { cooldown = defaultCooldown }
+        p.resting[index] = time.Now().Add(cooldown)
+    default:
+        return
+    }
+    if p.next == index { p.next = (index + 1) % len(p.credentials) }
+}
+
+// Usage returns a snapshot of per-key statistics, with the keys masked.
+func (p *KeyPool) Usage() []KeyUsage {
+    p.mu.Lock()
+    defer p.mu.Unlock()
+    usage := make([]KeyUsage, len(p.usage))
+    copy(usage, p.usage)
+    return usage
+}
+
+// LogUsage prints per-key statistics.
+func (p *KeyPool) LogUsage() {
+    for _, u := range p.Usage() {
+        status := "active"
+        if u.Disabled { status = "disabled" }
+        log.Printf("key %s at %s: %d requests, %d rejected, %d throttled, %s",
+            u.Key, u.Endpoint, u.Requests, u.Rejected, u.Throttled, status)
+    }
+}
+
+// MaskKey hides all but the last four characters of a key.
+func MaskKey(key string) string {
+    if len(key) <= 4 { return "****" }
+    return "****" + key[len(key)-4:]
+}
+
+// KeyID identifies a key without revealing it: unlike the masked key, it is
+// different for keys ending with the same characters.
+func KeyID(key string) string {
+    digest := sha256.Sum256([]byte(key))
+    return hex.EncodeToString(digest[:])[:8]
+}
+
+// sendWithPool tries keys of the pool one after another until one of them
+// isn't rejected or throttled.
+func (c *BingClient) sendWithPool(ctx context.Context, params SearchParams) (*ImagesCollection, error) {
+    var lastErr error
+    for attempt := 0; attempt < c.Keys.Len(); attempt++ {
+        index, credential, err := c.Keys.Pick()
+        if err != nil {
+            if lastErr != nil { return nil, lastErr }
+            return nil, err
+        }
+        result, err := c.send(ctx, credential.Endpoint, credential.Key, params)
+        c.Keys.Report(index, err)
+        if !isKeyError(err) { return result, err }
+        log.Printf("key %s at %s failed: %s", MaskKey(credential.Key), credential.Endpoint, err)
+        lastErr = err
+    }
+    return nil, lastErr
+}
+
+func isKeyError(err error) bool {
+    apiErr, ok := err.(*APIError)
+    if !ok { return false }
+    switch apiErr.StatusCode {
+    case http.StatusUnauthorized, http.StatusForbidden, http.StatusTooManyRequests: return true
+    default: return false
+    }
+}
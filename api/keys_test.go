@@ -0,0 +1,68 @@
+package api
+
+import (
+    "net/http"
+    "reflect"
+    "testing"
+    "time"
+)
+
+func TestKeyPoolRotation(t *testing.T) {
+    credentials := []Credential{{Endpoint:"a", Key:"key-a"}, {Endpoint:"b", Key:"key-b"}, {Endpoint:"c", Key:"key-c"}}
+    rejected := &APIError{StatusCode:http.StatusUnauthorized}
+    failed := &APIError{StatusCode:http.StatusInternalServerError}
+
+    tests := []struct {
+        name string
+        strategy RotationStrategy
+        // errors reported for the consecutive picks
+        errors []error
+        expected []string
+    }{
+        {"round robin", RoundRobin, []error{nil, nil, nil, nil}, []string{"a", "b", "c", "a"}},
+        {"round robin skips disabled", RoundRobin, []error{nil, rejected, nil, nil, nil}, []string{"a", "b", "c", "a", "c"}},
+        {"on failure keeps key", OnFailure, []error{nil, nil, nil}, []string{"a", "a", "a"}},
+        {"on failure moves on rejection", OnFailure, []error{nil, rejected, nil, nil}, []string{"a", "a", "b", "b"}},
+        {"server errors keep key", OnFailure, []error{failed, nil}, []string{"a", "a"}},
+    }
+    for _, test := range tests {
+        pool, err := NewKeyPool(credentials, test.strategy)
+        if err != nil { t.Fatal(err) }
+        picked := make([]string, 0)
+        for _, reported := range test.errors {
+            index, credential, err := pool.Pick()
+            if err != nil {
+                t.Errorf("%s: unexpected error: %s", test.name, err)
+                break
+            }
+            picked = append(picked, credential.Endpoint)
+            pool.Report(index, reported)
+        }
+        if !reflect.DeepEqual(picked, test.expected) {
+            t.Errorf("%s: expected keys %v, got %v", test.name, test.expected, picked)
+        }
+    }
+}
+
+func TestKeyPoolExhausted(t *testing.T) {
+    pool, err := NewKeyPool([]Credential{{Key:"key-a"}, {Key:"key-b"}}, RoundRobin)
+    if err != nil { t.Fatal(err) }
+    index, _, _ := pool.Pick()
+    pool.Report(index, &APIError{StatusCode:http.StatusForbidden})
+    index, _, _ = pool.Pick()
+    pool.Report(index, &APIError{StatusCode:http.StatusTooManyRequests, RetryAfter:time.Hour})
+
+    if _, _, err = pool.Pick(); err == nil { t.Errorf("expected an error when all keys are unavailable") }
+    usage := pool.Usage()
+    if !usage[0].Disabled || usage[0].Rejected != 1 || usage[1].Throttled != 1 {
+        t.Errorf("unexpected usage: %+v", usage)
+    }
+}
+
+func TestKeyID(t *testing.T) {
+    // same suffix, same mask, different ids
+    first, second := "aaaa-1234", "bbbb-1234"
+    if MaskKey(first) != MaskKey(second) { t.Fatalf("expected equal masks") }
+    if KeyID(first) == KeyID(second) { t.Errorf("expected different ids of %s and %s", first, second) }
+    if KeyID(first) != KeyID(first) || len(KeyID(first)) != 8 { t.Errorf("unexpected id: %s", KeyID(first)) }
+}
@@ -0,0 +1,90 @@
+package api
+
+import (
+    "context"
+    "net/http"
+    "strconv"
+    "strings"
+)
+
+const PexelsURL = "https://api.pexels.com/v1/search"
+
+// pexelsMaxPerPage is the largest page size Pexels API allows.
+const pexelsMaxPerPage = 80
+
+// PexelsClient searches free stock photos with Pexels API. The API pages by
+// number, so the offset is rounded down to the beginning of a page.
+type PexelsClient struct {
+    Endpoint string
+    SecretKey string
+    HTTPClient *http.Client
+}
+
+func NewPexelsClient(endpoint, key string) *PexelsClient {
+    return &PexelsClient{Endpoint:endpoint, SecretKey:key, HTTPClient:http.DefaultClient}
+}
+
+func (c *PexelsClient) Name() string {
+    return "pexels:" + c.Endpoint
+}
+
+type pexelsResponse struct {
+    Page int          `json:"page"`
+    PerPage int       `json:"per_page"`
+    NextPage string   `json:"next_page"`
+    Photos []struct {
+        ID int         `json:"id"`
+        Width int      `json:"width"`
+        Height int     `json:"height"`
+        URL string     `json:"url"`
+        Alt string     `json:"alt"`
+        AvgColor string `json:"avg_color"`
+        Src struct {
+            Original string `json:"original"`
+        } `json:"src"`
+    } `json:"photos"`
+}
+
+func (c *PexelsClient) RequestPage(ctx context.Context, params SearchParams) (*ImagesCollection, error) {
+    perPage := params.Count
+    if perPage <= 0 || perPage > pexelsMaxPerPage { perPage = pexelsMaxPerPage }
+    page := params.Offset / perPage + 1
+
+    request, err := http.NewRequest("GET", c.Endpoint, nil)
+    if err != nil { return nil, err }
+    query := request.URL.Query()
+    query.Set("query", params.Query)
+    query.Set("per_page", strconv.Itoa(perPage))
+    query.Set("page", strconv.Itoa(page))
+    if size := strings.ToLower(params.Size); size == "large" || size == "medium" || size == "small" {
+        query.Set("size", size)
+    }
+    if params.Color != "" && params.Color != "ColorOnly" {
+        query.Set("color", strings.ToLower(params.Color))
+    }
+    request.URL.RawQuery = query.Encode()
+    request.Header.Set("Authorization", c.SecretKey)
+
+    var response pexelsResponse
+    if err = getJSON(c.HTTPClient, request.WithContext(ctx), &response); err != nil { return nil, err }
+
+    first := (page - 1) * perPage
+    result := ImagesCollection{Query:params.Query, Offset:first, Values:make([]ImageResult, 0, len(response.Photos))}
+    for _, photo := range response.Photos {
+        result.Values = append(result.Values, ImageResult{
+            AccentColor: strings.TrimPrefix(photo.AvgColor, "#"),
+            EncodingFormat: formatFromURL(photo.Src.Original),
+            Height: photo.Height,
+            Width: photo.Width,
+            ImageID: strconv.Itoa(photo.ID),
+            Name: photo.Alt,
+            HostPageURL: photo.URL,
+            ContentURL: photo.Src.Original,
+        })
+    }
+    result.NextOffset = params.Offset
+    if response.NextPage != "" {
+        result.NextOffset = first + perPage
+    }
+    return &result, nil
+}
@@ -0,0 +1,41 @@
+package api
+
+import (
+    "bing/utils"
+    "context"
+    "encoding/json"
+    "net/http"
+    "net/url"
+    "path"
+    "strings"
+)
+
+// SearchProvider is an images search engine. Providers translate SearchParams
+// into their own requests as close as they can, and report the results in the
+// same shape as Bing does: Offset and Count select a page, and NextOffset of
+// the returned collection points to the following one, or equals to the
+// requested offset when there are no more results.
+type SearchProvider interface {
+    Name() string
+    RequestPage(ctx context.Context, params SearchParams) (*ImagesCollection, error)
+}
+
+// getJSON sends request and decodes JSON response into target.
+func getJSON(client *http.Client, request *http.Request, target interface{}) error {
+    response, err := client.Do(request)
+    if err != nil { return err }
+    defer utils.SilentClose(response.Body)
+    if response.StatusCode != http.StatusOK {
+        return newAPIError(response)
+    }
+    return json.NewDecoder(response.Body).Decode(target)
+}
+
+// formatFromURL guesses image encoding format from link's extension.
+func formatFromURL(link string) string {
+    parsed, err := url.Parse(link)
+    if err != nil { return "" }
+    ext := strings.ToLower(strings.TrimPrefix(path.Ext(parsed.Path), "."))
+    if ext == "jpg" { ext = "jpeg" }
+    return ext
+}
@@ -0,0 +1,125 @@
+package api
+
+import (
+    "context"
+    "log"
+    "sort"
+    "sync"
+)
+
+// DefaultConcurrency is the number of queries pulled at the same time when
+// PullOptions doesn't specify it.
+const DefaultConcurrency = 4
+
+type PullOptions struct {
+    // Start is the offset of the first requested page.
+    Start int
+    // DownloadAll makes the client follow pages until results are exhausted.
+    DownloadAll bool
+    // Concurrency limits the number of queries processed in parallel.
+    Concurrency int
+}
+
+// PullResult is a single page pulled for the query found at Index in the list
+// of queries; Page counts pages of the query starting from zero.
+type PullResult struct {
+    Query string
+    Index int
+    Page int
+    Collection *ImagesCollection
+    Err error
+}
+
+// PullStream pulls queries in parallel and sends the pages into the returned
+// channel as soon as they arrive. A failed query produces a result with Err
+// set and no further pages. The channel is closed when all queries are done or
+// ctx is cancelled.
+func (c *BingClient) PullStream(ctx context.Context, queries []string, options PullOptions) <-chan PullResult {
+    workers := options.Concurrency
+    if workers <= 0 { workers = DefaultConcurrency }
+
+    type task struct {
+        index int
+        query string
+    }
+
+    tasks := make(chan task)
+    results := make(chan PullResult, workers)
+
+    go func() {
+        defer close(tasks)
+        for i, query := range queries {
+            if query == "" { continue }
+            select {
+            case tasks <- task{i, query}:
+            case <-ctx.Done(): return
+            }
+        }
+    }()
+
+    var wg sync.WaitGroup
+    for i := 0; i < workers; i++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            for t := range tasks {
+                c.pullQuery(ctx, t.index, t.query, options, results)
+            }
+        }()
+    }
+
+    go func() {
+        wg.Wait()
+        close(results)
+    }()
+
+    return results
+}
+
+// PullParallel pulls queries in parallel and returns the pages ordered by the
+// query position and page number. Pages of the successful queries are returned
+// even if some queries failed; the failures are reported as QueryErrors.
+func (c *BingClient) PullParallel(ctx context.Context, queries []string, options PullOptions) ([]*ImagesCollection, error) {
+    var pulled []PullResult
+    var failed QueryErrors
+    for result := range c.PullStream(ctx, queries, options) {
+        if result.Err != nil {
+            log.Printf("%s", QueryError{result.Query, result.Err})
+            failed = append(failed, QueryError{result.Query, result.Err})
+        } else {
+            pulled = append(pulled, result)
+        }
+    }
+
+    sort.Slice(pulled, func(i, j int) bool {
+        if pulled[i].Index != pulled[j].Index { return pulled[i].Index < pulled[j].Index }
+        return pulled[i].Page < pulled[j].Page
+    })
+    collections := make([]*ImagesCollection, len(pulled))
+    for i, result := range pulled {
+        collections[i] = result.Collection
+    }
+
+    if err := ctx.Err(); err != nil { return collections, err }
+    if len(failed) > 0 { return collections, failed }
+    return collections, nil
+}
+
+// pullQuery requests pages of a single query and sends them into out.
+func (c *BingClient) pullQuery(ctx context.Context, index int, query string, options PullOptions, out chan<- PullResult) {
+    currOffset := options.Start
+    for page := 0; ; page++ {
+        params := CreateQuery(query, currOffset)
+        log.Printf("running query with params: %s", params.AsQueryParameters())
+        images, err := c.RequestPage(ctx, params)
+
+        select {
+        case out <- PullResult{Query:query, Index:index, Page:page, Collection:images, Err:err}:
+        case <-ctx.Done(): return
+        }
+
+        if err != nil || !options.DownloadAll { return }
+        if len(images.Values) == 0 || images.NextOffset == currOffset { return }
+        currOffset = images.NextOffset
+    }
+}
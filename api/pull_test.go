@@ -0,0 +1,166 @@
+package api_test
+
+import (
+    "bing/api"
+    "bing/mockbing"
+    "context"
+    "errors"
+    "fmt"
+    "net/http"
+    "net/http/httptest"
+    "reflect"
+    "sync"
+    "testing"
+    "time"
+)
+
+// gauge is a handler measuring the number of requests served at the same time.
+type gauge struct {
+    handler http.Handler
+    delay time.Duration
+    mu sync.Mutex
+    current int
+    peak int
+}
+
+func (g *gauge) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+    g.mu.Lock()
+    g.current++
+    if g.current > g.peak { g.peak = g.current }
+    g.mu.Unlock()
+
+    time.Sleep(g.delay)
+    g.handler.ServeHTTP(w, r)
+
+    g.mu.Lock()
+    g.current--
+    g.mu.Unlock()
+}
+
+func TestPullParallel(t *testing.T) {
+    tests := []struct {
+        name string
+        options mockbing.Options
+        queries []string
+        expected []string
+        failed []string
+    }{
+        {
+            name: "single pages",
+            options: mockbing.Options{Synthetic:3},
+            queries: []string{"cats", "dogs", "", "birds"},
+            expected: []string{"cats@0", "cats@3", "dogs@0", "dogs@3", "birds@0", "birds@3"},
+        },
+        {
+            name: "several pages",
+            options: mockbing.Options{Synthetic:320},
+            queries: []string{"cats", "dogs"},
+            expected: []string{"cats@0", "cats@150", "cats@300", "cats@320", "dogs@0", "dogs@150", "dogs@300", "dogs@320"},
+        },
+        {
+            name: "failed queries",
+            options: mockbing.Options{Synthetic:3, FailQueries:map[string]int{"dogs":400, "birds":403}},
+            queries: []string{"cats", "dogs", "birds", "mice"},
+            expected: []string{"cats@0", "cats@3", "mice@0", "mice@3"},
+            failed: []string{"dogs", "birds"},
+        },
+    }
+    for _, test := range tests {
+        server := mockbing.NewServer(nil, test.options).Start()
+        client := api.NewBingClient(mockbing.Endpoint(server.URL), "secret")
+        options := api.PullOptions{DownloadAll:true, Concurrency:3}
+
+        collections, err := client.PullParallel(context.Background(), test.queries, options)
+        server.Close()
+
+        pages := make([]string, len(collections))
+        for i, collection := range collections {
+            pages[i] = fmt.Sprintf("%s@%d", collection.Query, collection.Offset)
+        }
+        if !reflect.DeepEqual(pages, test.expected) {
+            t.Errorf("%s: expected pages %v, got %v", test.name, test.expected, pages)
+        }
+
+        var failed []string
+        var queryErrors api.QueryErrors
+        if errors.As(err, &queryErrors) {
+            for _, queryErr := range queryErrors {
+                failed = append(failed, queryErr.Query)
+            }
+        } else if err != nil {
+            t.Errorf("%s: unexpected error: %s", test.name, err)
+        }
+        if !sameItems(failed, test.failed) {
+            t.Errorf("%s: expected failed queries %v, got %v", test.name, test.failed, failed)
+        }
+    }
+}
+
+func TestPullConcurrency(t *testing.T) {
+    queries := []string{"a", "b", "c", "d", "e", "f", "g", "h"}
+    tests := []struct {
+        concurrency int
+        expected int
+    }{
+        {1, 1},
+        {3, 3},
+        {0, api.DefaultConcurrency},
+    }
+    for _, test := range tests {
+        measured := &gauge{handler:mockbing.NewServer(nil, mockbing.Options{Synthetic:2}), delay:20 * time.Millisecond}
+        server := httptest.NewServer(measured)
+        client := api.NewBingClient(mockbing.Endpoint(server.URL), "secret")
+
+        _, err := client.PullParallel(context.Background(), queries, api.PullOptions{Concurrency:test.concurrency})
+        server.Close()
+        if err != nil { t.Errorf("concurrency %d: unexpected error: %s", test.concurrency, err) }
+        if measured.peak != test.expected {
+            t.Errorf("concurrency %d: expected %d requests at once, got %d", test.concurrency, test.expected, measured.peak)
+        }
+    }
+}
+
+func TestPullStreamCancel(t *testing.T) {
+    measured := &gauge{handler:mockbing.NewServer(nil, mockbing.Options{Synthetic:2}), delay:20 * time.Millisecond}
+    server := httptest.NewServer(measured)
+    defer server.Close()
+    client := api.NewBingClient(mockbing.Endpoint(server.URL), "secret")
+
+    queries := make([]string, 100)
+    for i := range queries {
+        queries[i] = fmt.Sprintf("query %d", i)
+    }
+    ctx, cancel := context.WithCancel(context.Background())
+    results := client.PullStream(ctx, queries, api.PullOptions{Concurrency:2})
+    <-results
+    cancel()
+
+    received := 1
+    timeout := time.After(5 * time.Second)
+    for {
+        select {
+        case _, ok := <-results:
+            if !ok {
+                if received >= len(queries) { t.Errorf("all %d queries were pulled after cancel", received) }
+                return
+            }
+            received++
+        case <-timeout:
+            t.Fatal("results channel is not closed after cancel")
+        }
+    }
+}
+
+// sameItems tells if a and b have the same items in any order.
+func sameItems(a, b []string) bool {
+    if len(a) != len(b) { return false }
+    counts := make(map[string]int)
+    for _, item := range a {
+        counts[item]++
+    }
+    for _, item := range b {
+        counts[item]--
+        if counts[item] < 0 { return false }
+    }
+    return true
+}
@@ -0,0 +1,77 @@
+package api
+
+import (
+    "context"
+    "errors"
+    "log"
+    "net"
+    "net/http"
+    "sync"
+    "time"
+)
+
+// RetryPolicy repeats requests failed with throttling, server errors or
+// network problems. Backoff is the delay before the first retry and is doubled
+// with each next one, unless the API asks to wait longer.
+type RetryPolicy struct {
+    Attempts int
+    Backoff time.Duration
+}
+
+// Do calls fn until it succeeds, fails with an error which isn't worth
+// retrying, or the attempts are exhausted.
+func (p RetryPolicy) Do(ctx context.Context, fn func() error) error {
+    delay := p.Backoff
+    for attempt := 1; ; attempt++ {
+        err := fn()
+        if err == nil || attempt >= p.Attempts || !retryable(ctx, err) { return err }
+
+        wait := delay
+        if apiErr, ok := err.(*APIError); ok && apiErr.RetryAfter > wait { wait = apiErr.RetryAfter }
+        log.Printf("attempt %d of %d failed, retrying in %s: %s", attempt, p.Attempts, wait, err)
+        select {
+        case <-time.After(wait):
+        case <-ctx.Done(): return ctx.Err()
+        }
+        delay *= 2
+    }
+}
+
+// retryable tells if err is worth another attempt: throttling, a server error
+// or a network failure. Responses missing in a cassette and responses which
+// cannot be decoded fail at once.
+func retryable(ctx context.Context, err error) bool {
+    if ctx.Err() != nil || errors.Is(err, ErrNotRecorded) { return false }
+    if apiErr, ok := err.(*APIError); ok {
+        return apiErr.StatusCode == http.StatusTooManyRequests || apiErr.StatusCode >= 500
+    }
+    var netErr net.Error
+    return errors.As(err, &netErr)
+}
+
+// RateLimiter spaces requests evenly so no more than the given number of them
+// is sent per second.
+type RateLimiter struct {
+    interval time.Duration
+    mu sync.Mutex
+    next time.Time
+}
+
+func NewRateLimiter(perSecond float64) *RateLimiter {
+    return &RateLimiter{interval:time.Duration(float64(time.Second) / perSecond)}
+}
+
+// Wait blocks until the next request is allowed.
+func (l *RateLimiter) Wait(ctx context.Context) error {
+    l.mu.Lock()
+    now := time.Now()
+    if l.next.Before(now) { l.next = now }
+    slot := l.next
+    l.next = l.next.Add(l.interval)
+    l.mu.Unlock()
+
+    select {
+    case <-time.After(time.Until(slot)): return nil
+    case <-ctx.Done(): return ctx.Err()
+    }
+}
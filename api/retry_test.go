@@ -0,0 +1,39 @@
+package api
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "net"
+    "net/http"
+    "net/url"
+    "testing"
+)
+
+func TestRetryable(t *testing.T) {
+    cancelled, cancel := context.WithCancel(context.Background())
+    cancel()
+    timeout := &net.OpError{Op:"dial", Net:"tcp", Err:errors.New("i/o timeout")}
+
+    tests := []struct {
+        name string
+        ctx context.Context
+        err error
+        expected bool
+    }{
+        {"throttled", context.Background(), &APIError{StatusCode:http.StatusTooManyRequests}, true},
+        {"server error", context.Background(), &APIError{StatusCode:http.StatusBadGateway}, true},
+        {"bad request", context.Background(), &APIError{StatusCode:http.StatusBadRequest}, false},
+        {"unauthorized", context.Background(), &APIError{StatusCode:http.StatusUnauthorized}, false},
+        {"network", context.Background(), &url.Error{Op:"Get", URL:"http://x", Err:timeout}, true},
+        {"cassette miss", context.Background(), &url.Error{Op:"Get", URL:"http://x", Err:fmt.Errorf("cassette: %w", ErrNotRecorded)}, false},
+        {"invalid response", context.Background(), fmt.Errorf("%w: unexpected EOF", ErrInvalidResponse), false},
+        {"budget", context.Background(), ErrBudgetExceeded, false},
+        {"cancelled", cancelled, &APIError{StatusCode:http.StatusServiceUnavailable}, false},
+    }
+    for _, test := range tests {
+        if retryable(test.ctx, test.err) != test.expected {
+            t.Errorf("%s: expected retryable to be %v", test.name, test.expected)
+        }
+    }
+}
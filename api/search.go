@@ -0,0 +1,79 @@
+package api
+
+import "context"
+
+// ResultIterator walks over the results of a search one image at a time,
+// requesting the next page only when the current one is exhausted:
+//
+//     results := client.Search(ctx, CreateQuery("kittens", 0))
+//     for results.Next() {
+//         image := results.Result()
+//         ...
+//     }
+//     if err := results.Err(); err != nil { ... }
+//
+// The caller can stop at any moment, and no more requests are sent.
+type ResultIterator struct {
+    provider SearchProvider
+    ctx context.Context
+    params SearchParams
+    page []ImageResult
+    position int
+    current ImageResult
+    pages int
+    exhausted bool
+    err error
+}
+
+// Search returns an iterator over the results of params, starting from params.Offset.
+func (c *BingClient) Search(ctx context.Context, params SearchParams) *ResultIterator {
+    return NewResultIterator(ctx, c, params)
+}
+
+// NewResultIterator returns an iterator over the results of params pulled from provider.
+func NewResultIterator(ctx context.Context, provider SearchProvider, params SearchParams) *ResultIterator {
+    return &ResultIterator{provider:provider, ctx:ctx, params:params}
+}
+
+// Next advances the iterator to the next result, and reports whether there is one.
+func (it *ResultIterator) Next() bool {
+    if it.err != nil { return false }
+    for it.position >= len(it.page) {
+        if it.exhausted { return false }
+        if !it.fetch() { return false }
+    }
+    it.current = it.page[it.position]
+    it.position++
+    return true
+}
+
+// Result returns the result the iterator points to.
+func (it *ResultIterator) Result() ImageResult { return it.current }
+
+// Err returns the error which stopped the iteration, if any.
+func (it *ResultIterator) Err() error { return it.err }
+
+// Pages returns the number of pages requested so far.
+func (it *ResultIterator) Pages() int { return it.pages }
+
+// fetch requests the next page and reports whether it succeeded.
+func (it *ResultIterator) fetch() bool {
+    if err := it.ctx.Err(); err != nil {
+        it.err = err
+        return false
+    }
+
+    images, err := it.provider.RequestPage(it.ctx, it.params)
+    if err != nil {
+        it.err = err
+        return false
+    }
+    it.pages++
+
+    it.page, it.position = images.Values, 0
+    if len(images.Values) == 0 || images.NextOffset <= it.params.Offset {
+        it.exhausted = true
+    }
+    it.params.Offset = images.NextOffset
+    return true
+}
@@ -0,0 +1,68 @@
+package api_test
+
+import (
+    "bing/api"
+    "bing/mockbing"
+    "context"
+    "testing"
+)
+
+func TestResultIterator(t *testing.T) {
+    tests := []struct {
+        name string
+        options mockbing.Options
+        offset int
+        take int
+        expected int
+        requests int
+        fails bool
+    }{
+        {name:"all pages", options:mockbing.Options{Synthetic:320}, take:-1, expected:320, requests:4},
+        {name:"from offset", options:mockbing.Options{Synthetic:320}, offset:200, take:-1, expected:120, requests:2},
+        {name:"stop on first page", options:mockbing.Options{Synthetic:320}, take:10, expected:10, requests:1},
+        {name:"stop on page boundary", options:mockbing.Options{Synthetic:320}, take:150, expected:150, requests:1},
+        {name:"stop on second page", options:mockbing.Options{Synthetic:320}, take:151, expected:151, requests:2},
+        {name:"no results", options:mockbing.Options{}, take:-1, expected:0, requests:1},
+        {name:"failed page", options:mockbing.Options{Synthetic:320, FailEvery:2}, take:-1, expected:150, requests:2, fails:true},
+    }
+    for _, test := range tests {
+        mock := mockbing.NewServer(nil, test.options)
+        server := mock.Start()
+        client := api.NewBingClient(mockbing.Endpoint(server.URL), "secret")
+
+        results := client.Search(context.Background(), api.CreateQuery("cats", test.offset))
+        seen := make(map[string]bool)
+        for (test.take < 0 || len(seen) < test.take) && results.Next() {
+            seen[results.Result().ContentURL] = true
+        }
+        requests := mock.Requests()
+        server.Close()
+
+        if len(seen) != test.expected {
+            t.Errorf("%s: expected %d unique results, got %d", test.name, test.expected, len(seen))
+        }
+        if requests != test.requests {
+            t.Errorf("%s: expected %d requests, got %d", test.name, test.requests, requests)
+        }
+        if test.fails != (results.Err() != nil) {
+            t.Errorf("%s: unexpected error: %v", test.name, results.Err())
+        }
+        if test.fails && results.Next() {
+            t.Errorf("%s: iteration goes on after the failure", test.name)
+        }
+    }
+}
+
+func TestResultIteratorCancelled(t *testing.T) {
+    mock := mockbing.NewServer(nil, mockbing.Options{Synthetic:10})
+    server := mock.Start()
+    defer server.Close()
+    client := api.NewBingClient(mockbing.Endpoint(server.URL), "secret")
+
+    ctx, cancel := context.WithCancel(context.Background())
+    cancel()
+    results := client.Search(ctx, api.CreateQuery("cats", 0))
+    if results.Next() { t.Error("expected no results after cancel") }
+    if results.Err() != context.Canceled { t.Errorf("expected %s, got %v", context.Canceled, results.Err()) }
+    if mock.Requests() != 0 { t.Errorf("expected no requests, got %d", mock.Requests()) }
+}
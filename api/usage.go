@@ -0,0 +1,146 @@
+package api
+
+import (
+    "bing/utils"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io/ioutil"
+    "os"
+    "sort"
+    "strings"
+    "sync"
+    "time"
+)
+
+// DefaultPricePerThousand is the price in USD of 1000 transactions at S1 tier.
+const DefaultPricePerThousand = 7.0
+
+var ErrBudgetExceeded = errors.New("API transactions budget is exceeded")
+
+// Budget limits the number of transactions; zero means no limit.
+type Budget struct {
+    Daily int
+    Monthly int
+}
+
+// UsageTracker counts billable transactions per key and day, and keeps the
+// totals in a file, so budgets are enforced across runs. Keys are stored as
+// their KeyID.
+type UsageTracker struct {
+    File string
+    Budget Budget
+    PricePerThousand float64
+
+    mu sync.Mutex
+    days map[string]map[string]int
+    // masked keys of this run by their ids, to show in the summary
+    masked map[string]string
+    session int
+}
+
+// LoadUsageTracker reads totals from file, if it exists.
+func LoadUsageTracker(file string, budget Budget) (*UsageTracker, error) {
+    tracker := &UsageTracker{
+        File: file,
+        Budget: budget,
+        PricePerThousand: DefaultPricePerThousand,
+        days: make(map[string]map[string]int),
+        masked: make(map[string]string),
+    }
+    data, err := ioutil.ReadFile(file)
+    if os.IsNotExist(err) { return tracker, nil }
+    if err != nil { return nil, err }
+    if err = json.Unmarshal(data, &tracker.days); err != nil {
+        return nil, fmt.Errorf("invalid usage file %s: %s", file, err)
+    }
+    return tracker, nil
+}
+
+// Reserve counts a transaction made with key, or returns ErrBudgetExceeded if
+// the transaction would exceed the budget.
+func (t *UsageTracker) Reserve(key string) error {
+    t.mu.Lock()
+    defer t.mu.Unlock()
+    day := today()
+    if t.Budget.Daily > 0 && t.totalFor(day) >= t.Budget.Daily { return ErrBudgetExceeded }
+    if t.Budget.Monthly > 0 && t.totalFor(day[:7]) >= t.Budget.Monthly { return ErrBudgetExceeded }
+    id := KeyID(key)
+    t.masked[id] = MaskKey(key)
+    t.add(day, id, 1)
+    t.session++
+    return nil
+}
+
+// Release takes back a reserved transaction which wasn't billed.
+func (t *UsageTracker) Release(key string) {
+    t.mu.Lock()
+    defer t.mu.Unlock()
+    t.add(today(), KeyID(key), -1)
+    t.session--
+}
+
+// Exceeded reports whether no more transactions are allowed today.
+func (t *UsageTracker) Exceeded() bool {
+    t.mu.Lock()
+    defer t.mu.Unlock()
+    day := today()
+    return (t.Budget.Daily > 0 && t.totalFor(day) >= t.Budget.Daily) ||
+           (t.Budget.Monthly > 0 && t.totalFor(day[:7]) >= t.Budget.Monthly)
+}
+
+// Save writes totals into the file.
+func (t *UsageTracker) Save() error {
+    t.mu.Lock()
+    defer t.mu.Unlock()
+    data, err := json.MarshalIndent(t.days, "", " ")
+    if err != nil { return err }
+    return utils.WriteFileAtomic(t.File, data)
+}
+
+// Summary describes transactions and their cost for this run, today and this month.
+func (t *UsageTracker) Summary() string {
+    t.mu.Lock()
+    defer t.mu.Unlock()
+    day := today()
+    session, daily, monthly := t.session, t.totalFor(day), t.totalFor(day[:7])
+    var b strings.Builder
+    fmt.Fprintf(&b, "API usage: %d transactions in this run ($%.2f), %d today ($%.2f), %d this month ($%.2f)",
+        session, t.cost(session), daily, t.cost(daily), monthly, t.cost(monthly))
+    if t.Budget.Daily > 0 { fmt.Fprintf(&b, "; daily budget %d", t.Budget.Daily) }
+    if t.Budget.Monthly > 0 { fmt.Fprintf(&b, "; monthly budget %d", t.Budget.Monthly) }
+    ids := make([]string, 0, len(t.days[day]))
+    for id := range t.days[day] { ids = append(ids, id) }
+    sort.Strings(ids)
+    for _, id := range ids {
+        count, key := t.days[day][id], id
+        if masked, ok := t.masked[id]; ok { key = fmt.Sprintf("%s (%s)", masked, id) }
+        fmt.Fprintf(&b, "\n  key %s: %d transactions today", key, count)
+    }
+    return b.String()
+}
+
+// totalFor sums transactions of all keys over the days starting with prefix.
+func (t *UsageTracker) totalFor(prefix string) int {
+    total := 0
+    for day, keys := range t.days {
+        if !strings.HasPrefix(day, prefix) { continue }
+        for _, count := range keys {
+            total += count
+        }
+    }
+    return total
+}
+
+func (t *UsageTracker) add(day, key string, n int) {
+    if t.days[day] == nil { t.days[day] = make(map[string]int) }
+    t.days[day][key] += n
+}
+
+func (t *UsageTracker) cost(transactions int) float64 {
+    return float64(transactions) * t.PricePerThousand / 1000
+}
+
+func today() string {
+    return time.Now().UTC().Format("2006-01-02")
+}
@@ -0,0 +1,68 @@
+package api
+
+import (
+    "context"
+    "net/http"
+    "net/http/httptest"
+    "path"
+    "sort"
+    "strings"
+    "testing"
+)
+
+func TestUsageCounting(t *testing.T) {
+    tests := []struct {
+        name string
+        status int
+        body string
+        counted int
+    }{
+        {"success", http.StatusOK, `{"value":[]}`, 1},
+        {"undecodable success", http.StatusOK, `{"value":`, 1},
+        {"throttled", http.StatusTooManyRequests, `{}`, 0},
+        {"server error", http.StatusInternalServerError, `{}`, 0},
+        {"no response", 0, "", 0},
+    }
+    for _, test := range tests {
+        server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            w.WriteHeader(test.status)
+            _, _ = w.Write([]byte(test.body))
+        }))
+        endpoint := server.URL
+        if test.status == 0 {
+            server.Close()
+        } else {
+            defer server.Close()
+        }
+
+        usage, err := LoadUsageTracker(path.Join(t.TempDir(), "usage.json"), Budget{})
+        if err != nil { t.Fatal(err) }
+        client := NewBingClient(endpoint, "secret")
+        client.Usage = usage
+        _, _ = client.RequestPage(context.Background(), SearchParams{Query:"cats", Count:1})
+
+        if counted := usage.totalFor(today()); counted != test.counted {
+            t.Errorf("%s: expected %d transactions, got %d", test.name, test.counted, counted)
+        }
+    }
+}
+
+func TestUsageSummary(t *testing.T) {
+    usage, err := LoadUsageTracker(path.Join(t.TempDir(), "usage.json"), Budget{Daily:10})
+    if err != nil { t.Fatal(err) }
+    keys := []string{"key-3", "key-1", "key-2", "key-1"}
+    for _, key := range keys {
+        if err = usage.Reserve(key); err != nil { t.Fatal(err) }
+    }
+
+    lines := strings.Split(usage.Summary(), "\n")[1:]
+    if len(lines) != 3 { t.Fatalf("expected 3 keys in summary, got %v", lines) }
+    ids := []string{KeyID("key-1"), KeyID("key-2"), KeyID("key-3")}
+    sort.Strings(ids)
+    for i, id := range ids {
+        if !strings.Contains(lines[i], id) { t.Errorf("expected key %s in line %d: %v", id, i, lines) }
+    }
+    if !strings.Contains(strings.Join(lines, "\n"), "key ****ey-1 (" + KeyID("key-1") + "): 2 transactions") {
+        t.Errorf("unexpected summary: %v", lines)
+    }
+}
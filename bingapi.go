@@ -4,15 +4,128 @@ import (
     "bing/api"
     "bing/cli"
     "bing/crawler"
-    "bing/io"
+    "errors"
+    "log"
+    "net/http"
+    "os"
+    "time"
 )
 
 func main() {
-    conf := cli.ParseArguments()
-    client := api.NewBingClient(cli.GetBingEndpoint(), cli.GetBingKey())
-    crawl := crawler.Crawler{Client:client, NumWorkers:*conf.NumWorkers}
-    switch *conf.Mode {
-    case "query": crawl.Crawl(conf.QueryList, *conf.OutputFolder, io.ToJSON)
-    case "download": crawl.Download(*conf.File, *conf.OutputFolder, io.FromJSON)
+    os.Exit(cli.Main("bing", commands(), os.Args[1:]))
+}
+
+// newCrawler creates the crawler with the search provider chosen in conf.
+// The returned function prints the usage of API keys, if there is any.
+func newCrawler(conf *cli.RunConfig) (*crawler.Crawler, func(), error) {
+    api.DefaultSearchParams = conf.Search
+    provider, err := newProvider(conf)
+    if err != nil { return nil, nil, err }
+
+    crawl := &crawler.Crawler{
+        Provider: provider,
+        NumWorkers: conf.NumWorkers,
+        DownloadTimeout: time.Duration(conf.Download.Timeout),
+        ShardSize: int64(conf.Download.ShardSize) << 20,
+    }
+    report := func() {}
+    // replayed responses cost nothing, so they are neither counted nor limited
+    if client, ok := provider.(*api.BingClient); ok && conf.Replay == "" {
+        budget := api.Budget{Daily:conf.Usage.DailyBudget, Monthly:conf.Usage.MonthlyBudget}
+        usage, err := api.LoadUsageTracker(conf.Usage.File, budget)
+        if err != nil { return nil, nil, err }
+        usage.PricePerThousand = conf.Usage.PricePerThousand
+        client.Usage = usage
+        crawl.Usage = usage
+        if client.Keys != nil { report = client.Keys.LogUsage }
+    }
+    return crawl, report, nil
+}
+
+// newProvider creates the search provider chosen in conf, and wires the cassette
+// and the cache into it.
+func newProvider(conf *cli.RunConfig) (api.SearchProvider, error) {
+    var cassette *api.Cassette
+    var err error
+    if conf.Replay != "" {
+        cassette, err = api.NewCassette(conf.Replay, api.Replay)
+    } else if conf.Record != "" {
+        cassette, err = api.NewCassette(conf.Record, api.Record)
+    }
+    if err != nil { return nil, err }
+    replaying := conf.Replay != ""
+
+    httpClient := http.DefaultClient
+    if cassette != nil { httpClient = &http.Client{Transport:cassette} }
+
+    switch conf.Provider {
+    case "pexels":
+        key := ""
+        if !replaying {
+            if key, err = cli.GetPexelsKey(); err != nil { return nil, err }
+        }
+        client := api.NewPexelsClient(conf.PexelsEndpoint, key)
+        client.HTTPClient = httpClient
+        return client, nil
+
+    case "json":
+        endpoint, err := api.LoadJSONEndpoint(conf.ProviderConfig)
+        if err != nil { return nil, err }
+        endpoint.HTTPClient = httpClient
+        return endpoint, nil
+
+    default:
+        var client *api.BingClient
+        pool, err := cli.GetBingKeyPool(conf.BingEndpoint, conf.RotationStrategy())
+        if err != nil { return nil, err }
+        if pool != nil {
+            client = api.NewBingClientPool(pool)
+        } else {
+            key := cli.GetBingKeyOrEmpty()
+            if !replaying {
+                if key, err = cli.GetBingKey(); err != nil { return nil, err }
+            }
+            client = api.NewBingClient(conf.BingEndpoint, key)
+        }
+        client.HTTPClient = httpClient
+        client.Retry = api.RetryPolicy{Attempts:conf.Retry.Attempts, Backoff:time.Duration(conf.Retry.Backoff)}
+        if conf.RateLimit.RequestsPerSecond > 0 {
+            client.Limiter = api.NewRateLimiter(conf.RateLimit.RequestsPerSecond)
+        }
+        if conf.Cache.Folder != "" {
+            cache, err := api.NewResponseCache(conf.Cache.Folder, time.Duration(conf.Cache.TTL))
+            if err != nil { return nil, err }
+            client.Cache = cache
+        }
+        return client, nil
+    }
+}
+
+// fail logs err and returns the failure exit code.
+func fail(err error) int {
+    log.Printf("%s", err)
+    return cli.ExitFailure
+}
+
+// setupError logs err of preparing a command and returns its exit code: the
+// one of invalid arguments if the keys in the environment are wrong.
+func setupError(err error) int {
+    if errors.Is(err, cli.ErrInvalidKeys) { return usageError(err) }
+    return fail(err)
+}
+
+// usageError logs err and returns the exit code of invalid arguments.
+func usageError(err error) int {
+    log.Printf("%s", err)
+    return cli.ExitUsage
+}
+
+// newDownloader creates the crawler used only to download images, so no search
+// provider and keys are needed.
+func newDownloader(conf *cli.RunConfig) *crawler.Crawler {
+    return &crawler.Crawler{
+        NumWorkers: conf.NumWorkers,
+        DownloadTimeout: time.Duration(conf.Download.Timeout),
+        ShardSize: int64(conf.Download.ShardSize) << 20,
     }
 }
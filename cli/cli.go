@@ -1,59 +1,163 @@
 package cli
 
 import (
+    "bing/io"
     "flag"
+    "fmt"
     "io/ioutil"
-    "log"
     "os"
     "strings"
+    "time"
 )
 
-type RunConfig struct {
-    Mode *string
-    Query *string
-    File *string
-    OutputFolder *string
-    QueryList []string
-    NumWorkers *int
-}
-
-func ParseArguments() *RunConfig {
-    conf := RunConfig{}
-    conf.Mode = flag.String("m", "query", "execution mode: 'query' or 'download'")
-    conf.Query = flag.String("q", "", "search query")
-    conf.File = flag.String("f", "",
-        "a path to the file with search queries, one per line, or to the folder with URLs")
-    conf.OutputFolder = flag.String("o", "output", "path to the folder with dumped queries")
-    conf.NumWorkers = flag.Int("j", 10, "number of workers (jobs)")
-    flag.Parse()
-
-    if *conf.Mode == "query" {
-
-        if (*conf.Query == "") && (*conf.File == "") {
-            log.Fatalln("Cannot run search without -q or -f arguments provided.")
-        } else if (*conf.Query != "") && (*conf.File != "") {
-            log.Fatalln("Ambiguous arguments: both -q and -f are specified.")
-        }
+// Exit codes of the commands.
+const (
+    ExitOK = 0
+    // ExitFailure means the command ran but didn't succeed.
+    ExitFailure = 1
+    // ExitUsage means the command line is invalid.
+    ExitUsage = 2
+)
+
+// Command is a subcommand of the tool with its own flags.
+type Command struct {
+    Name string
+    Summary string
+    // Args describes positional arguments in the usage line.
+    Args string
+    // Flags declares command's flags writing into conf.
+    Flags func(flags *flag.FlagSet, conf *RunConfig)
+    // Run executes the command with the remaining positional arguments and
+    // returns the exit code.
+    Run func(conf *RunConfig, args []string) int
+}
+
+// Main finds the command named by the first argument, builds its config and
+// runs it. The returned value is the process exit code.
+func Main(program string, commands []Command, args []string) int {
+    if len(args) == 0 {
+        printUsage(program, commands)
+        return ExitUsage
+    }
+    name := args[0]
+    if name == "help" || name == "-h" || name == "-help" || name == "--help" {
+        if len(args) > 1 { return Main(program, commands, []string{args[1], "-h"}) }
+        printUsage(program, commands)
+        return ExitOK
+    }
 
-        fileName := *conf.File
-        useFile := fileName != ""
-        if useFile {
-            if data, err := ioutil.ReadFile(fileName); err != nil {
-                if os.IsNotExist(err) { log.Fatalf("File doesn't exist: %s", fileName) }
-                if os.IsPermission(err) { log.Fatalf("Permission error: %s", err.Error()) }
-            } else {
-                content := string(data)
-                conf.QueryList = strings.Split(content, "\n")
-            }
-        } else {
-            conf.QueryList = []string{*conf.Query}
+    for _, command := range commands {
+        if command.Name != name { continue }
+        conf, rest, err := parseCommand(program, command, args[1:])
+        if err == flag.ErrHelp { return ExitOK }
+        if err != nil {
+            fmt.Fprintf(os.Stderr, "%s %s: %s\n", program, name, err)
+            return ExitUsage
         }
+        return command.Run(conf, rest)
+    }
+
+    fmt.Fprintf(os.Stderr, "%s: unknown command '%s'\n\n", program, name)
+    printUsage(program, commands)
+    return ExitUsage
+}
 
-    } else if *conf.Mode == "download" {
-        // do nothing
-    } else {
-        log.Fatalf("unknown execution mode: %s", *conf.Mode)
+// parseCommand builds the config of command from defaults, the config file,
+// environment and the flags, in the order of increasing precedence.
+func parseCommand(program string, command Command, args []string) (*RunConfig, []string, error) {
+    // the first pass only validates the flags and finds the config file
+    var configFile string
+    scratch := DefaultRunConfig()
+    first := newFlagSet(program, command, &scratch, &configFile)
+    if err := first.Parse(args); err != nil { return nil, nil, err }
+
+    conf := DefaultRunConfig()
+    if configFile != "" {
+        if err := conf.LoadFile(configFile); err != nil { return nil, nil, err }
     }
+    if err := conf.LoadEnv(); err != nil { return nil, nil, err }
+
+    second := newFlagSet(program, command, &conf, &configFile)
+    second.SetOutput(ioutil.Discard)
+    if err := second.Parse(args); err != nil { return nil, nil, err }
+    return &conf, second.Args(), nil
+}
 
-    return &conf
+func newFlagSet(program string, command Command, conf *RunConfig, configFile *string) *flag.FlagSet {
+    flags := flag.NewFlagSet(command.Name, flag.ContinueOnError)
+    flags.StringVar(configFile, "config", "", "a path to the JSON config file")
+    if command.Flags != nil { command.Flags(flags, conf) }
+    flags.Usage = func() {
+        out := flags.Output()
+        fmt.Fprintf(out, "Usage: %s %s [flags] %s\n\n%s\n\nFlags:\n", program, command.Name, command.Args, command.Summary)
+        flags.PrintDefaults()
+    }
+    return flags
+}
+
+func printUsage(program string, commands []Command) {
+    fmt.Fprintf(os.Stderr, "Usage: %s <command> [flags] [arguments]\n\nCommands:\n", program)
+    for _, command := range commands {
+        fmt.Fprintf(os.Stderr, "  %-10s %s\n", command.Name, command.Summary)
+    }
+    fmt.Fprintf(os.Stderr, "\nRun '%s help <command>' for the command's flags.\n", program)
+    fmt.Fprintf(os.Stderr, "Exit codes: %d success, %d failure, %d invalid arguments.\n",
+        ExitOK, ExitFailure, ExitUsage)
+}
+
+// QueryFlags declares the flags choosing what to search for.
+func QueryFlags(flags *flag.FlagSet, conf *RunConfig) {
+    flags.StringVar(&conf.Query, "q", conf.Query, "search query")
+    flags.StringVar(&conf.File, "f", conf.File,
+        "a path to the file with search queries, one per line, '-' reads them from stdin")
+}
+
+// SearchFlags declares the flags configuring the search provider.
+func SearchFlags(flags *flag.FlagSet, conf *RunConfig) {
+    flags.IntVar(&conf.NumWorkers, "j", conf.NumWorkers, "number of workers (jobs)")
+    flags.StringVar(&conf.OutputFolder, "o", conf.OutputFolder,
+        "path to the folder with dumped queries, '-' writes JSON lines to stdout")
+    flags.StringVar(&conf.Format, "format", conf.Format,
+        "format of dumped queries, one of: " + strings.Join(io.FormatNames(), ", ") + "; stdout gets JSON lines")
+    flags.StringVar(&conf.Compression, "compress", conf.Compression,
+        "compression of dumped queries: 'gzip' or 'zstd'; compressed files are read back by their extension, stdout is never compressed")
+    flags.StringVar(&conf.Record, "record", conf.Record, "path to the folder to record API responses into")
+    flags.StringVar(&conf.Replay, "replay", conf.Replay, "path to the folder to replay recorded API responses from")
+    flags.StringVar(&conf.Cache.Folder, "cache", conf.Cache.Folder, "path to the folder to cache API responses in")
+    flags.DurationVar((*time.Duration)(&conf.Cache.TTL), "cache-ttl", time.Duration(conf.Cache.TTL),
+        "how long cached responses stay valid, 0 means forever")
+    flags.StringVar(&conf.Provider, "provider", conf.Provider, "search provider: 'bing', 'pexels' or 'json'")
+    flags.StringVar(&conf.ProviderConfig, "provider-config", conf.ProviderConfig,
+        "a path to the JSON file describing the endpoint for 'json' provider")
+    flags.StringVar(&conf.Rotation, "rotate", conf.Rotation,
+        "how to rotate keys from BING_API_KEYS: 'round-robin' or 'on-failure'")
+    flags.StringVar(&conf.Usage.File, "usage-file", conf.Usage.File,
+        "path to the file keeping the number of API transactions across runs")
+    flags.IntVar(&conf.Usage.DailyBudget, "daily-budget", conf.Usage.DailyBudget,
+        "maximum number of API transactions per day, 0 means no limit")
+    flags.IntVar(&conf.Usage.MonthlyBudget, "monthly-budget", conf.Usage.MonthlyBudget,
+        "maximum number of API transactions per month, 0 means no limit")
+    flags.Float64Var(&conf.Usage.PricePerThousand, "price", conf.Usage.PricePerThousand,
+        "price of 1000 API transactions in USD, used to estimate the cost")
+    flags.IntVar(&conf.Retry.Attempts, "retries", conf.Retry.Attempts,
+        "number of attempts for a failed search request")
+    flags.Float64Var(&conf.RateLimit.RequestsPerSecond, "rps", conf.RateLimit.RequestsPerSecond,
+        "maximum number of search requests per second, 0 means no limit")
+}
+
+// DownloadFlags declares the flags configuring images downloading.
+func DownloadFlags(flags *flag.FlagSet, conf *RunConfig) {
+    if flags.Lookup("j") == nil {
+        flags.IntVar(&conf.NumWorkers, "j", conf.NumWorkers, "number of workers (jobs)")
+    }
+    flags.StringVar(&conf.ImagesFolder, "images", conf.ImagesFolder, "path to the folder with downloaded images")
+    // commands searching before the download read their own results
+    if flags.Lookup("format") == nil {
+        flags.StringVar(&conf.InputFormat, "input-format", conf.InputFormat,
+            "format of the results to download from, detected by file extensions if not set")
+    }
+    flags.DurationVar((*time.Duration)(&conf.Download.Timeout), "download-timeout",
+        time.Duration(conf.Download.Timeout), "timeout of a single image download")
+    flags.IntVar(&conf.Download.ShardSize, "shard-size", conf.Download.ShardSize,
+        "pack images with their metadata into tar shards of this many megabytes, 0 saves separate files")
 }
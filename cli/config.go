@@ -0,0 +1,220 @@
+package cli
+
+import (
+    "bing/api"
+    "bing/io"
+    "encoding/json"
+    "fmt"
+    "io/ioutil"
+    "log"
+    "os"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// Duration is time.Duration written in config files as a string, e.g. "90s".
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+    return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+    var text string
+    if err := json.Unmarshal(data, &text); err != nil { return err }
+    parsed, err := time.ParseDuration(text)
+    if err != nil { return err }
+    *d = Duration(parsed)
+    return nil
+}
+
+type CacheConfig struct {
+    Folder string  `json:"folder"`
+    TTL Duration   `json:"ttl"`
+}
+
+type UsageConfig struct {
+    File string               `json:"file"`
+    DailyBudget int           `json:"dailyBudget"`
+    MonthlyBudget int         `json:"monthlyBudget"`
+    PricePerThousand float64  `json:"pricePerThousand"`
+}
+
+type RetryConfig struct {
+    Attempts int      `json:"attempts"`
+    Backoff Duration  `json:"backoff"`
+}
+
+type RateLimitConfig struct {
+    // RequestsPerSecond limits search requests; zero means no limit.
+    RequestsPerSecond float64 `json:"requestsPerSecond"`
+}
+
+type DownloadConfig struct {
+    Timeout Duration `json:"timeout"`
+    // ShardSize is the size of tar shards in megabytes, 0 means separate files.
+    ShardSize int    `json:"shardSize,omitempty"`
+}
+
+// RunConfig is the effective configuration of a run. The values come from
+// defaults, overridden by the config file, then by environment variables and,
+// finally, by command line flags. Subscription keys are read from environment
+// only and never stored in the config.
+type RunConfig struct {
+    Query string              `json:"query,omitempty"`
+    File string               `json:"file,omitempty"`
+    OutputFolder string       `json:"outputFolder"`
+    Format string             `json:"format"`
+    InputFormat string        `json:"inputFormat,omitempty"`
+    Compression string        `json:"compression,omitempty"`
+    ImagesFolder string       `json:"imagesFolder"`
+    NumWorkers int            `json:"workers"`
+    Provider string           `json:"provider"`
+    ProviderConfig string     `json:"providerConfig,omitempty"`
+    BingEndpoint string       `json:"bingEndpoint"`
+    PexelsEndpoint string     `json:"pexelsEndpoint"`
+    Rotation string           `json:"rotation"`
+    Record string             `json:"record,omitempty"`
+    Replay string             `json:"replay,omitempty"`
+    Cache CacheConfig         `json:"cache"`
+    Usage UsageConfig         `json:"usage"`
+    Search api.SearchParams   `json:"search"`
+    Retry RetryConfig         `json:"retry"`
+    RateLimit RateLimitConfig `json:"rateLimit"`
+    Download DownloadConfig   `json:"download"`
+
+    QueryList []string        `json:"-"`
+}
+
+func DefaultRunConfig() RunConfig {
+    return RunConfig{
+        OutputFolder: "output",
+        Format: "json",
+        ImagesFolder: "images",
+        NumWorkers: 10,
+        Provider: "bing",
+        BingEndpoint: api.DefaultURL,
+        PexelsEndpoint: api.PexelsURL,
+        Rotation: "round-robin",
+        Cache: CacheConfig{TTL:Duration(24*time.Hour)},
+        Usage: UsageConfig{File:".bing-usage.json", PricePerThousand:api.DefaultPricePerThousand},
+        Search: api.DefaultSearchParams,
+        Retry: RetryConfig{Attempts:3, Backoff:Duration(time.Second)},
+        Download: DownloadConfig{Timeout:Duration(time.Hour)},
+    }
+}
+
+// LoadFile overrides the values of conf with the ones found in JSON file;
+// the options missing in the file keep their values.
+func (c *RunConfig) LoadFile(fileName string) error {
+    data, err := ioutil.ReadFile(fileName)
+    if err != nil { return err }
+    if err = json.Unmarshal(data, c); err != nil {
+        return fmt.Errorf("invalid config file %s: %s", fileName, err)
+    }
+    return nil
+}
+
+// LoadEnv overrides the values of conf with environment variables.
+func (c *RunConfig) LoadEnv() error {
+    variables := map[string]*string{
+        "BING_ENDPOINT": &c.BingEndpoint,
+        "PEXELS_ENDPOINT": &c.PexelsEndpoint,
+        "BING_OUTPUT": &c.OutputFolder,
+        "BING_IMAGES": &c.ImagesFolder,
+        "BING_CACHE": &c.Cache.Folder,
+        "BING_USAGE_FILE": &c.Usage.File,
+    }
+    for name, target := range variables {
+        if value := os.Getenv(name); value != "" { *target = value }
+    }
+    if value := os.Getenv("BING_WORKERS"); value != "" {
+        n, err := strconv.Atoi(value)
+        if err != nil { return fmt.Errorf("invalid BING_WORKERS: %s", err) }
+        c.NumWorkers = n
+    }
+    return nil
+}
+
+// Print writes the effective config as JSON.
+func (c *RunConfig) Print() {
+    data, _ := json.MarshalIndent(c, "", "  ")
+    fmt.Println(string(data))
+}
+
+// ValidateSearch checks the options used to query a search provider.
+func (c *RunConfig) ValidateSearch() error {
+    if (c.Record != "") && (c.Replay != "") {
+        return fmt.Errorf("ambiguous arguments: both -record and -replay are specified")
+    }
+    switch c.Provider {
+    case "bing", "pexels":
+    case "json":
+        if c.ProviderConfig == "" {
+            return fmt.Errorf("cannot use 'json' provider without -provider-config argument")
+        }
+    default:
+        return fmt.Errorf("unknown search provider: %s", c.Provider)
+    }
+    if _, err := io.LookupFormat(c.Format); err != nil { return err }
+    compression, err := io.LookupCompression(c.Compression)
+    if err != nil { return err }
+    if compression != nil && c.Format == "sqlite" {
+        return fmt.Errorf("sqlite format cannot be compressed")
+    }
+    // standard output always gets plain JSON lines
+    if c.OutputFolder == io.Stdout {
+        if c.Format != "json" && c.Format != "jsonl" {
+            return fmt.Errorf("cannot write %s format to stdout, it gets JSON lines", c.Format)
+        }
+        if compression != nil { return fmt.Errorf("cannot compress the results written to stdout") }
+    }
+    if (c.Rotation != "round-robin") && (c.Rotation != "on-failure") {
+        return fmt.Errorf("unknown key rotation strategy: %s", c.Rotation)
+    }
+    if (c.Provider != "bing") && (c.Cache.Folder != "") {
+        return fmt.Errorf("caching is supported only for 'bing' provider")
+    }
+    return nil
+}
+
+// LoadQueries fills QueryList from -q or -f options; '-f -' reads standard input.
+func (c *RunConfig) LoadQueries() error {
+    if (c.Query == "") && (c.File == "") {
+        return fmt.Errorf("cannot run search without -q or -f arguments provided")
+    } else if (c.Query != "") && (c.File != "") {
+        return fmt.Errorf("ambiguous arguments: both -q and -f are specified")
+    }
+
+    if c.File == "" {
+        c.QueryList = []string{strings.TrimSpace(c.Query)}
+        return nil
+    }
+
+    input := os.Stdin
+    if c.File != "-" {
+        file, err := os.Open(c.File)
+        if os.IsNotExist(err) {
+            return fmt.Errorf("file doesn't exist: %s", c.File)
+        } else if err != nil {
+            return err
+        }
+        defer file.Close()
+        input = file
+    }
+
+    queries, stats, err := ParseQueries(input)
+    if err != nil { return err }
+    log.Printf("loaded %d queries, skipped %d: %d duplicates, %d comments, %d blank lines",
+        stats.Loaded, stats.Skipped(), stats.Duplicates, stats.Comments, stats.Blank)
+    if len(queries) == 0 { return fmt.Errorf("no queries found in %s", c.File) }
+    c.QueryList = queries
+    return nil
+}
+
+// RotationStrategy returns key rotation strategy chosen with -rotate.
+func (c *RunConfig) RotationStrategy() api.RotationStrategy {
+    if c.Rotation == "on-failure" { return api.OnFailure }
+    return api.RoundRobin
+}
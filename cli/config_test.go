@@ -0,0 +1,29 @@
+package cli
+
+import "testing"
+
+func TestValidateSearch(t *testing.T) {
+    tests := []struct {
+        name string
+        update func(conf *RunConfig)
+        fails bool
+    }{
+        {"defaults", func(conf *RunConfig) {}, false},
+        {"compressed jsonl", func(conf *RunConfig) { conf.Format, conf.Compression = "jsonl", "zstd" }, false},
+        {"compressed sqlite", func(conf *RunConfig) { conf.Format, conf.Compression = "sqlite", "gzip" }, true},
+        {"unknown format", func(conf *RunConfig) { conf.Format = "xml" }, true},
+        {"record and replay", func(conf *RunConfig) { conf.Record, conf.Replay = "a", "b" }, true},
+        {"stdout", func(conf *RunConfig) { conf.OutputFolder = "-" }, false},
+        {"stdout jsonl", func(conf *RunConfig) { conf.OutputFolder, conf.Format = "-", "jsonl" }, false},
+        {"stdout csv", func(conf *RunConfig) { conf.OutputFolder, conf.Format = "-", "csv" }, true},
+        {"stdout compressed", func(conf *RunConfig) { conf.OutputFolder, conf.Compression = "-", "gzip" }, true},
+        {"stdout not compressed", func(conf *RunConfig) { conf.OutputFolder, conf.Compression = "-", "none" }, false},
+    }
+    for _, test := range tests {
+        conf := DefaultRunConfig()
+        test.update(&conf)
+        if err := conf.ValidateSearch(); test.fails != (err != nil) {
+            t.Errorf("%s: unexpected result: %v", test.name, err)
+        }
+    }
+}
@@ -2,23 +2,53 @@ package cli
 
 import (
     "bing/api"
+    "errors"
     "fmt"
     "os"
+    "strings"
 )
 
-func GetBingKey() string {
+// ErrInvalidKeys is returned when API keys in the environment are missing or
+// malformed, which is a usage error rather than a failure of a command.
+var ErrInvalidKeys = errors.New("invalid API keys")
+
+func GetBingKey() (string, error) {
     bingKey := os.Getenv("BING_API_KEY")
-    if bingKey == "" {
-        fmt.Println("Cannot run query without a key.")
-        os.Exit(1)
-    }
-    return bingKey
+    if bingKey == "" { return "", fmt.Errorf("%w: cannot run query without BING_API_KEY", ErrInvalidKeys) }
+    return bingKey, nil
 }
 
-func GetBingEndpoint() string {
-    bingEndpoint := os.Getenv("BING_ENDPOINT")
-    if bingEndpoint == "" {
-        bingEndpoint = api.DefaultURL
+// GetBingKeyOrEmpty is the same as GetBingKey, but doesn't require the key, e.g.
+// when responses are replayed from a cassette.
+func GetBingKeyOrEmpty() string {
+    return os.Getenv("BING_API_KEY")
+}
+
+func GetPexelsKey() (string, error) {
+    pexelsKey := os.Getenv("PEXELS_API_KEY")
+    if pexelsKey == "" { return "", fmt.Errorf("%w: cannot run query without PEXELS_API_KEY", ErrInvalidKeys) }
+    return pexelsKey, nil
+}
+
+// GetBingKeyPool reads BING_API_KEYS, a comma-separated list of keys, each
+// optionally followed by '@' and the endpoint the key is issued for; keys
+// without an endpoint use defaultEndpoint. Returns nil if the variable isn't set.
+func GetBingKeyPool(defaultEndpoint string, strategy api.RotationStrategy) (*api.KeyPool, error) {
+    value := os.Getenv("BING_API_KEYS")
+    if value == "" { return nil, nil }
+
+    var credentials []api.Credential
+    for _, item := range strings.Split(value, ",") {
+        item = strings.TrimSpace(item)
+        if item == "" { continue }
+        credential := api.Credential{Key:item, Endpoint:defaultEndpoint}
+        if at := strings.Index(item, "@"); at >= 0 {
+            credential.Key, credential.Endpoint = item[:at], item[at+1:]
+        }
+        credentials = append(credentials, credential)
     }
-    return bingEndpoint
-}
\ No newline at end of file
+
+    pool, err := api.NewKeyPool(credentials, strategy)
+    if err != nil { return nil, fmt.Errorf("%w: BING_API_KEYS: %s", ErrInvalidKeys, err) }
+    return pool, nil
+}
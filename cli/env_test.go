@@ -0,0 +1,59 @@
+package cli
+
+import (
+    "bing/api"
+    "errors"
+    "testing"
+)
+
+func TestGetBingKeyPool(t *testing.T) {
+    tests := []struct {
+        value string
+        keys int
+        fails bool
+    }{
+        {"", 0, false},
+        {"key1", 1, false},
+        {" key1 , key2@http://eastus/search, ", 2, false},
+        {"@http://eastus/search", 0, true},
+        {",", 0, true},
+    }
+    for _, test := range tests {
+        t.Setenv("BING_API_KEYS", test.value)
+        pool, err := GetBingKeyPool("http://default/search", api.RoundRobin)
+        if test.fails {
+            if !errors.Is(err, ErrInvalidKeys) { t.Errorf("%q: expected %s, got %v", test.value, ErrInvalidKeys, err) }
+            continue
+        }
+        if err != nil {
+            t.Errorf("%q: unexpected error: %s", test.value, err)
+        } else if test.keys == 0 && pool != nil {
+            t.Errorf("%q: expected no pool", test.value)
+        } else if test.keys > 0 && (pool == nil || pool.Len() != test.keys) {
+            t.Errorf("%q: expected %d keys", test.value, test.keys)
+        }
+    }
+}
+
+func TestGetKeys(t *testing.T) {
+    tests := []struct {
+        variable string
+        value string
+        get func() (string, error)
+    }{
+        {"BING_API_KEY", "secret", GetBingKey},
+        {"BING_API_KEY", "", GetBingKey},
+        {"PEXELS_API_KEY", "secret", GetPexelsKey},
+        {"PEXELS_API_KEY", "", GetPexelsKey},
+    }
+    for _, test := range tests {
+        t.Setenv(test.variable, test.value)
+        key, err := test.get()
+        if test.value == "" && !errors.Is(err, ErrInvalidKeys) {
+            t.Errorf("%s: expected %s, got %v", test.variable, ErrInvalidKeys, err)
+        }
+        if test.value != "" && (err != nil || key != test.value) {
+            t.Errorf("%s: expected %q, got %q: %v", test.variable, test.value, key, err)
+        }
+    }
+}
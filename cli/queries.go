@@ -0,0 +1,57 @@
+package cli
+
+import (
+    "bufio"
+    "io"
+    "strings"
+)
+
+// QueryStats tells how many lines of a queries file were used and skipped.
+type QueryStats struct {
+    Loaded int
+    Blank int
+    Comments int
+    Duplicates int
+}
+
+func (s QueryStats) Skipped() int {
+    return s.Blank + s.Comments + s.Duplicates
+}
+
+// ParseQueries reads search strings, one per line. Lines are trimmed, so both
+// LF and CRLF files work, and a leading byte order mark is dropped. Blank lines
+// and lines starting with '#' are skipped, as well as the queries repeating
+// earlier ones regardless of case and extra whitespace.
+func ParseQueries(r io.Reader) ([]string, QueryStats, error) {
+    var stats QueryStats
+    queries := make([]string, 0)
+    seen := make(map[string]bool)
+
+    scanner := bufio.NewScanner(r)
+    first := true
+    for scanner.Scan() {
+        line := scanner.Text()
+        if first {
+            line = strings.TrimPrefix(line, "\uFEFF")
+            first = false
+        }
+        line = strings.TrimSpace(line)
+
+        switch {
+        case line == "":
+            stats.Blank++
+        case strings.HasPrefix(line, "#"):
+            stats.Comments++
+        default:
+            key := strings.ToLower(strings.Join(strings.Fields(line), " "))
+            if seen[key] {
+                stats.Duplicates++
+                continue
+            }
+            seen[key] = true
+            queries = append(queries, line)
+            stats.Loaded++
+        }
+    }
+    return queries, stats, scanner.Err()
+}
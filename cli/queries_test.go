@@ -0,0 +1,38 @@
+package cli
+
+import (
+    "reflect"
+    "strings"
+    "testing"
+)
+
+func TestParseQueries(t *testing.T) {
+    tests := []struct {
+        name string
+        input string
+        queries []string
+        stats QueryStats
+    }{
+        {"plain", "cats\ndogs\n", []string{"cats", "dogs"}, QueryStats{Loaded:2}},
+        {"windows line endings", "cats\r\ndogs\r\n", []string{"cats", "dogs"}, QueryStats{Loaded:2}},
+        {"byte order mark", "\uFEFFcats\n", []string{"cats"}, QueryStats{Loaded:1}},
+        {"comments and blanks", "# animals\n\ncats\n   \n  # more\ndogs", []string{"cats", "dogs"}, QueryStats{Loaded:2, Blank:2, Comments:2}},
+        {"trimmed", "  red cats \t\n", []string{"red cats"}, QueryStats{Loaded:1}},
+        {"duplicates", "Red Cats\nred  cats\nRED CATS \ndogs\n", []string{"Red Cats", "dogs"}, QueryStats{Loaded:2, Duplicates:2}},
+        {"hash inside query", "c# books\n", []string{"c# books"}, QueryStats{Loaded:1}},
+        {"empty", "", []string{}, QueryStats{}},
+    }
+    for _, test := range tests {
+        queries, stats, err := ParseQueries(strings.NewReader(test.input))
+        if err != nil {
+            t.Errorf("%s: unexpected error: %s", test.name, err)
+            continue
+        }
+        if !reflect.DeepEqual(queries, test.queries) {
+            t.Errorf("%s: expected queries %q, got %q", test.name, test.queries, queries)
+        }
+        if stats != test.stats {
+            t.Errorf("%s: expected stats %+v, got %+v", test.name, test.stats, stats)
+        }
+    }
+}
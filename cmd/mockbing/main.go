@@ -0,0 +1,36 @@
+package main
+
+import (
+    "bing/mockbing"
+    "flag"
+    "log"
+    "net/http"
+)
+
+func main() {
+    addr := flag.String("addr", "localhost:8080", "address to listen on")
+    folder := flag.String("fixtures", "", "path to the folder with JSON fixtures")
+    key := flag.String("key", "", "expected subscription key, any key is accepted if empty")
+    synthetic := flag.Int("synthetic", 100,
+        "number of generated results for queries missing in fixtures")
+    rps := flag.Int("rps", 0, "maximum number of search requests per second, 0 means no limit")
+    failEvery := flag.Int("fail-every", 0, "fail each N-th search request with 500")
+    flag.Parse()
+
+    fixtures := make(mockbing.Fixtures)
+    if *folder != "" {
+        loaded, err := mockbing.LoadFixtures(*folder)
+        if err != nil { log.Fatalf("cannot load fixtures: %s", err) }
+        fixtures = loaded
+        log.Printf("loaded fixtures for %d queries from %s", len(fixtures), *folder)
+    }
+
+    server := mockbing.NewServer(fixtures, mockbing.Options{
+        Key: *key,
+        Synthetic: *synthetic,
+        RequestsPerSecond: *rps,
+        FailEvery: *failEvery,
+    })
+    log.Printf("serving search endpoint at %s", mockbing.Endpoint("http://" + *addr))
+    log.Fatal(http.ListenAndServe(*addr, server))
+}
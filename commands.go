@@ -0,0 +1,209 @@
+package main
+
+import (
+    "bing/cli"
+    "bing/crawler"
+    "bing/io"
+    "bing/utils"
+    "flag"
+    "fmt"
+    "log"
+    "os"
+    "path/filepath"
+)
+
+func commands() []cli.Command {
+    return []cli.Command{
+        {
+            Name: "search",
+            Summary: "Send queries to the search provider and save the results into the output folder.",
+            Flags: func(flags *flag.FlagSet, conf *cli.RunConfig) {
+                cli.QueryFlags(flags, conf)
+                cli.SearchFlags(flags, conf)
+            },
+            Run: runSearch,
+        },
+        {
+            Name: "download",
+            Summary: "Download the images found by previous searches, or listed in an exported CSV file.",
+            Args: "[metadata-folder | file.csv]",
+            Flags: cli.DownloadFlags,
+            Run: runDownload,
+        },
+        {
+            Name: "run",
+            Summary: "Search and download the found images as soon as the pages arrive.",
+            Flags: func(flags *flag.FlagSet, conf *cli.RunConfig) {
+                cli.QueryFlags(flags, conf)
+                cli.SearchFlags(flags, conf)
+                cli.DownloadFlags(flags, conf)
+            },
+            Run: runSearchAndDownload,
+        },
+        {
+            Name: "stats",
+            Summary: "Summarize folders with search results or downloaded images.",
+            Args: "folder...",
+            Run: runStats,
+        },
+        {
+            Name: "export",
+            Summary: "Convert search results into another format.",
+            Args: "metadata-folder",
+            Flags: exportFlags,
+            Run: runExport,
+        },
+        {
+            Name: "dataset",
+            Summary: "Describe downloaded images in a format labeling tools import.",
+            Args: "[images-folder]",
+            Flags: datasetFlags,
+            Run: runDataset,
+        },
+        {
+            Name: "dedupe",
+            Summary: "List unique image links found by searches, with the queries that found them.",
+            Args: "metadata-folder",
+            Flags: dedupeFlags,
+            Run: runDedupe,
+        },
+        {
+            Name: "verify",
+            Summary: "Check that downloaded images exist and can be decoded.",
+            Args: "[images-folder]",
+            Run: runVerify,
+        },
+        {
+            Name: "config",
+            Summary: "Show the effective configuration merged from defaults, config file, environment and flags.",
+            Args: "print",
+            Flags: func(flags *flag.FlagSet, conf *cli.RunConfig) {
+                cli.QueryFlags(flags, conf)
+                cli.SearchFlags(flags, conf)
+                cli.DownloadFlags(flags, conf)
+            },
+            Run: runConfig,
+        },
+    }
+}
+
+func runSearch(conf *cli.RunConfig, args []string) int {
+    if len(args) > 0 { return usageError(fmt.Errorf("unexpected arguments: %v", args)) }
+    if err := conf.ValidateSearch(); err != nil { return usageError(err) }
+    if err := conf.LoadQueries(); err != nil { return usageError(err) }
+    if err := removeTempFiles(conf.OutputFolder); err != nil { return fail(err) }
+
+    crawl, report, err := newCrawler(conf)
+    if err != nil { return setupError(err) }
+    defer report()
+    export, done, err := exporter(conf, crawl)
+    if err != nil { return fail(err) }
+    err = crawl.Crawl(conf.QueryList, conf.OutputFolder, export)
+    if err = finish(err, done); err != nil { return fail(err) }
+    return cli.ExitOK
+}
+
+func runDownload(conf *cli.RunConfig, args []string) int {
+    metadataFolder := conf.OutputFolder
+    switch len(args) {
+    case 0:
+    case 1: metadataFolder = args[0]
+    default: return usageError(fmt.Errorf("expected a single metadata folder, got: %v", args))
+    }
+
+    var format io.Format
+    var err error
+    if conf.InputFormat != "" {
+        format, err = io.LookupFormat(conf.InputFormat)
+    } else if format, err = io.DetectFormat(metadataFolder); err == nil {
+        log.Printf("detected '%s' format of %s", format.Name, metadataFolder)
+    }
+    if err != nil { return usageError(err) }
+    if format.Import == nil { return usageError(fmt.Errorf("cannot download from '%s' format", format.Name)) }
+
+    if err = removeTempFiles(imageFolders(conf)...); err != nil { return fail(err) }
+
+    crawl := newDownloader(conf)
+    scan := format.Scanner()
+    if format.Name == "sqlite" {
+        // the attempts are recorded into the same database
+        store, err := io.OpenExistingStore(metadataFolder)
+        if err != nil { return fail(err) }
+        defer store.Close()
+        scan = io.ImporterScanner(func(string) ([]io.ImageRecord, error) { return store.Records() })
+        crawl.Downloads = store
+    }
+
+    if err = crawl.DownloadScanned(metadataFolder, conf.ImagesFolder, scan); err != nil { return fail(err) }
+    return cli.ExitOK
+}
+
+func runSearchAndDownload(conf *cli.RunConfig, args []string) int {
+    if len(args) > 0 { return usageError(fmt.Errorf("unexpected arguments: %v", args)) }
+    if err := conf.ValidateSearch(); err != nil { return usageError(err) }
+    if err := conf.LoadQueries(); err != nil { return usageError(err) }
+    if err := removeTempFiles(append(imageFolders(conf), conf.OutputFolder)...); err != nil { return fail(err) }
+
+    crawl, report, err := newCrawler(conf)
+    if err != nil { return setupError(err) }
+    defer report()
+    export, done, err := exporter(conf, crawl)
+    if err != nil { return fail(err) }
+    err = crawl.Pipeline(conf.QueryList, conf.OutputFolder, conf.ImagesFolder, export)
+    if err = finish(err, done); err != nil { return fail(err) }
+    return cli.ExitOK
+}
+
+func runConfig(conf *cli.RunConfig, args []string) int {
+    if len(args) != 1 || args[0] != "print" {
+        return usageError(fmt.Errorf("expected 'print' argument"))
+    }
+    conf.Print()
+    return cli.ExitOK
+}
+
+// exporter opens the output in the format chosen with -format; outputs able to
+// keep download attempts, like a database, also record the downloads of crawl.
+// The returned function finishes the export and should be called when the
+// search is over.
+func exporter(conf *cli.RunConfig, crawl *crawler.Crawler) (io.Exporter, func() error, error) {
+    if conf.OutputFolder == io.Stdout { return io.NewStreamExporter(os.Stdout), func() error { return nil }, nil }
+    format, err := io.LookupFormat(conf.Format)
+    if err != nil { return nil, nil, err }
+
+    if err = os.MkdirAll(conf.OutputFolder, os.ModePerm); err != nil { return nil, nil, err }
+    compression, err := io.LookupCompression(conf.Compression)
+    if err != nil { return nil, nil, err }
+    output, err := format.Open(conf.OutputFolder, compression)
+    if err != nil { return nil, nil, err }
+    if recorder, ok := output.(crawler.DownloadRecorder); ok { crawl.Downloads = recorder }
+    return output.Export, func() error {
+        if err := output.Close(); err != nil { return fmt.Errorf("cannot finish %s output: %s", format.Name, err) }
+        return nil
+    }, nil
+}
+
+// finish finishes the export with done even if the search failed with err, so
+// the pages found are kept, and returns the first of the errors.
+func finish(err error, done func() error) error {
+    if doneErr := done(); doneErr != nil {
+        if err == nil { return doneErr }
+        log.Printf("%s", doneErr)
+    }
+    return err
+}
+
+// removeTempFiles deletes the files left unfinished in folders by interrupted
+// runs, before new ones are written there.
+func removeTempFiles(folders ...string) error {
+    for _, folder := range folders {
+        if folder == io.Stdout { continue }
+        if err := utils.RemoveTempFiles(folder); err != nil { return err }
+    }
+    return nil
+}
+
+// imageFolders lists the folders images are downloaded into.
+func imageFolders(conf *cli.RunConfig) []string {
+    return []string{conf.ImagesFolder, filepath.Join(conf.ImagesFolder, crawler.DownloadsFolder)}
+}
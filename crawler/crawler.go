@@ -4,44 +4,76 @@ import (
     "bing/api"
     "bing/io"
     "bing/utils"
+    "context"
     "encoding/json"
     "io/ioutil"
     "log"
     "os"
     "path"
+    "path/filepath"
     "sync"
+    "time"
 )
 
-// Crawler takes Bing API client instance and sends queries to the search engine.
+// Crawler takes search provider instance and sends queries to the search engine.
 // It also responsible for taking URLs from search results and using them to
 // download the images into a local folder.
 type Crawler struct {
-    Client *api.BingClient
+    Provider api.SearchProvider
     NumWorkers int
+    // Usage, if set, is checked before crawling and summarized afterwards.
+    Usage *api.UsageTracker
+    // DownloadTimeout limits a single image download, one hour if not set.
+    DownloadTimeout time.Duration
+    // Downloads, if set, records every download attempt besides the manifest.
+    Downloads DownloadRecorder
+    // ShardSize, if set, makes downloaders pack images with their metadata
+    // into tar shards of about this many bytes, instead of separate files.
+    ShardSize int64
+}
+
+// DownloadRecorder keeps the outcome of download attempts, e.g. io.Store does.
+type DownloadRecorder interface {
+    RecordDownload(url, filename, errMessage string) error
 }
 
 // result contains a collection of URLs from query, or error if query failed.
 type result struct {
+    query string
     collection *api.ImagesCollection
     err error
 }
 
 // Crawl takes list of strings and send them (in parallel) the images search endpoint.
 // A result of each query represents a JSON object that is saved onto local disk with
-// exportFunc into outputFolder.
-func (c *Crawler) Crawl(queries []string, outputFolder string, exportFunc io.Exporter) {
-    client := c.Client
+// exportFunc into outputFolder. Failed queries are returned as api.QueryErrors.
+func (c *Crawler) Crawl(queries []string, outputFolder string, exportFunc io.Exporter) error {
+    if c.Usage != nil {
+        if c.Usage.Exceeded() {
+            log.Print(c.Usage.Summary())
+            return api.ErrBudgetExceeded
+        }
+        defer func() { log.Print(c.Usage.Summary()) }()
+    }
+
+    provider := c.Provider
     resultsQueue := make(chan result, 10)
     queriesQueue := make(chan string)
-    utils.Check(os.MkdirAll(outputFolder, os.ModePerm))
+    if outputFolder != io.Stdout {
+        utils.Check(os.MkdirAll(outputFolder, os.ModePerm))
+    }
 
     go enqueueStrings(queries, queriesQueue)
 
+    ctx, cancel := context.WithCancel(context.Background())
+    defer cancel()
+    failed := &failures{cancel:cancel}
+
     var workerGroup sync.WaitGroup
     for i := 1; i <= c.NumWorkers; i++ {
         log.Printf("submitting querying worker %d of %d", i, c.NumWorkers)
         workerGroup.Add(1)
-        go queryWorker(i, queriesQueue, resultsQueue, &workerGroup, client)
+        go queryWorker(ctx, i, queriesQueue, resultsQueue, &workerGroup, provider)
     }
 
     go func() {
@@ -55,44 +87,92 @@ func (c *Crawler) Crawl(queries []string, outputFolder string, exportFunc io.Exp
     for i := 1; i <= c.NumWorkers; i++ {
         log.Printf("Submitting writing worker %d of %d", i, c.NumWorkers)
         writerGroup.Add(1)
-        go writingWorker(i, outputFolder, resultsQueue, &writerGroup, exportFunc)
+        go writingWorker(i, outputFolder, resultsQueue, &writerGroup, exportFunc, failed)
     }
 
     log.Printf("waiting for writers...")
     writerGroup.Wait()
     log.Printf("collected results are saved into folder: %s", outputFolder)
+    return failed.err()
 }
 
-// downloaded contains image URL and downloading success status.
+// ManifestFile is the name of the file Download writes its results into.
+const ManifestFile = "collected.json"
+
+// DownloadsFolder is the subfolder of the images folder the images are saved
+// into, unless they are packed into shards.
+const DownloadsFolder = "collected"
+
+// Downloaded contains image URL and downloading success status, with the image
+// metadata known from search results.
 type Downloaded struct {
-    URL string      `json:"url"`
-    Filename string `json:"filename"`
-    Error error     `json:"error,omitempty"`
+    URL string        `json:"url"`
+    Queries []string  `json:"queries,omitempty"`
+    Filename string   `json:"filename"`
+    // Shard is the tar file with the image, if shards are used; Filename is
+    // the name of the image inside it then.
+    Shard string      `json:"shard,omitempty"`
+    Error string      `json:"error,omitempty"`
+    Width int         `json:"width,omitempty"`
+    Height int        `json:"height,omitempty"`
+    Format string     `json:"format,omitempty"`
+}
+
+// ImagePath returns where the image downloaded into imagesFolder is now: the
+// file names of the manifest are relative to the directory Download was run
+// from, so they are resolved against the folder the manifest is in.
+func ImagePath(imagesFolder string, item Downloaded) string {
+    return filepath.Join(imagesFolder, DownloadsFolder, filepath.Base(item.Filename))
+}
+
+// LoadManifest reads results of Download from imagesFolder.
+func LoadManifest(imagesFolder string) ([]Downloaded, error) {
+    data, err := ioutil.ReadFile(path.Join(imagesFolder, ManifestFile))
+    if err != nil { return nil, err }
+    var collected []Downloaded
+    err = json.Unmarshal(data, &collected)
+    return collected, err
 }
 
 // Download takes previously retrieved queries results from metaDataFolder and starts
 // downloading them into imagesFolder. The importFunc is used to read queries files
-// from disk.
-func (c *Crawler) Download(metaDataFolder, imagesFolder string, importFunc io.Importer) {
+// from disk. Links repeated across pages are downloaded only once.
+func (c *Crawler) Download(metaDataFolder, imagesFolder string, importFunc io.Importer) error {
+    return c.DownloadScanned(metaDataFolder, imagesFolder, io.ImporterScanner(importFunc))
+}
+
+// DownloadScanned works like Download, reading the results with scan. Only the
+// records with links not seen before are kept, so results with many duplicates
+// are never loaded into memory in full.
+func (c *Crawler) DownloadScanned(metaDataFolder, imagesFolder string, scan io.Scanner) error {
     log.Printf("loading image URLs from folder: %s", metaDataFolder)
 
-    downloadedFolder := path.Join(imagesFolder, "collected")
-    utils.Check(os.MkdirAll(downloadedFolder, os.ModePerm))
-    urls, err := importFunc(metaDataFolder, "contentUrl")
-    if err != nil{
-        log.Printf("%s", err)
-        return
+    links := io.NewURLSet()
+    unique := make([]io.ImageRecord, 0)
+    err := scan(metaDataFolder, func(record io.ImageRecord) error {
+        if links.Add(record.ContentURL, record.Query) { unique = append(unique, record) }
+        return nil
+    })
+    if err != nil { return err }
+    log.Printf("loaded %d unique links, %d duplicates skipped", links.Len(), links.Skipped())
+    downloadedFolder, shards, err := c.prepareImages(imagesFolder)
+    if err != nil { return err }
+    if shards != nil { defer shards.Close() }
+
+    // every query of the links is known, so it goes into shards too
+    tasks := make([]task, len(unique))
+    for i, sourced := range links.Sourced() {
+        tasks[i] = task{ImageRecord:unique[i], Queries:sourced.Queries}
     }
-
-    feed := make(chan string, c.NumWorkers)
-    go enqueueStrings(urls, feed)
+    feed := make(chan task, c.NumWorkers)
+    go enqueueTasks(tasks, feed)
 
     log.Printf("launching workers...")
     var workerGroup sync.WaitGroup
     results := make(chan Downloaded)
     for i := 1; i <= c.NumWorkers; i++ {
         workerGroup.Add(1)
-        go downloadingWorker(i, downloadedFolder, feed, results, &workerGroup)
+        go downloadingWorker(i, downloadedFolder, shards, c.downloadTimeout(), feed, results, &workerGroup)
     }
 
     go func(){
@@ -103,11 +183,72 @@ func (c *Crawler) Download(metaDataFolder, imagesFolder string, importFunc io.Im
 
     collected := make([]Downloaded, 0)
     for result := range results {
+        c.record(result)
         collected = append(collected, result)
     }
-
-    collectedJSON, _ := json.Marshal(collected)
-    metaFile := path.Join(imagesFolder, "collected.json")
-    _ = ioutil.WriteFile(metaFile, collectedJSON, os.ModePerm)
+    if err = finishDownloads(imagesFolder, collected, links, shards); err != nil { return err }
     log.Printf("collected results are saved into folder: %s", imagesFolder)
+    return nil
+}
+
+// task is an image to download with the queries known to have found it.
+type task struct {
+    io.ImageRecord
+    Queries []string `json:"queries,omitempty"`
+}
+
+// finishDownloads closes the shards and writes the manifest of collected
+// images. The manifest is written even if the shards fail to close, so the
+// images packed before are not lost.
+func finishDownloads(imagesFolder string, collected []Downloaded, links *io.URLSet, shards *io.ShardWriter) error {
+    setQueries(collected, links)
+    var closeErr error
+    if shards != nil { closeErr = shards.Close() }
+    if err := writeManifest(imagesFolder, collected); err != nil { return err }
+    return closeErr
+}
+
+// prepareImages creates the folder for downloaded images, or the shards writer
+// if ShardSize is set.
+func (c *Crawler) prepareImages(imagesFolder string) (string, *io.ShardWriter, error) {
+    if c.ShardSize > 0 {
+        shards, err := io.NewShardWriter(imagesFolder, c.ShardSize)
+        return imagesFolder, shards, err
+    }
+    downloadedFolder := path.Join(imagesFolder, DownloadsFolder)
+    if err := os.MkdirAll(downloadedFolder, os.ModePerm); err != nil { return "", nil, err }
+    return downloadedFolder, nil, nil
+}
+
+// setQueries fills the queries of collected images with every query that found
+// their links.
+func setQueries(collected []Downloaded, links *io.URLSet) {
+    sources := make(map[string][]string)
+    for _, link := range links.Sourced() {
+        sources[link.URL] = link.Queries
+    }
+    for i := range collected {
+        collected[i].Queries = sources[collected[i].URL]
+    }
+}
+
+// writeManifest saves downloading results into imagesFolder.
+func writeManifest(imagesFolder string, collected []Downloaded) error {
+    collectedJSON, err := json.Marshal(collected)
+    if err != nil { return err }
+    metaFile := path.Join(imagesFolder, ManifestFile)
+    return utils.WriteFileAtomic(metaFile, collectedJSON)
+}
+
+// record passes downloaded to the recorder, if there is one.
+func (c *Crawler) record(downloaded Downloaded) {
+    if c.Downloads == nil { return }
+    if err := c.Downloads.RecordDownload(downloaded.URL, downloaded.Filename, downloaded.Error); err != nil {
+        log.Printf("cannot record download of %s: %s", downloaded.URL, err)
+    }
+}
+
+func (c *Crawler) downloadTimeout() time.Duration {
+    if c.DownloadTimeout <= 0 { return time.Hour }
+    return c.DownloadTimeout
 }
@@ -0,0 +1,336 @@
+package crawler
+
+import (
+    "archive/tar"
+    "bing/api"
+    "bing/io"
+    "bing/mockbing"
+    "encoding/json"
+    "errors"
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "path"
+    "reflect"
+    "sort"
+    "strings"
+    "sync"
+    "testing"
+)
+
+// collector is an exporter keeping the crawled images in memory.
+type collector struct {
+    mu sync.Mutex
+    images map[string][]api.ImageResult
+}
+
+func (c *collector) export(collection *api.ImagesCollection, _ string) error {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    c.images[collection.Query] = append(c.images[collection.Query], collection.Values...)
+    return nil
+}
+
+func TestCrawl(t *testing.T) {
+    tests := []struct {
+        name string
+        fixtures mockbing.Fixtures
+        options mockbing.Options
+        replay bool
+        queries []string
+        expected map[string]int
+        failed []string
+    }{
+        {
+            name: "single page",
+            options: mockbing.Options{Synthetic:5},
+            queries: []string{"cats", "dogs"},
+            expected: map[string]int{"cats":5, "dogs":5},
+        },
+        {
+            name: "several pages",
+            options: mockbing.Options{Synthetic:320},
+            queries: []string{"cats"},
+            expected: map[string]int{"cats":320},
+        },
+        {
+            name: "failed query",
+            options: mockbing.Options{Synthetic:3, FailQueries:map[string]int{"dogs":400}},
+            queries: []string{"cats", "dogs"},
+            expected: map[string]int{"cats":3},
+            failed: []string{"dogs"},
+        },
+        {
+            name: "not recorded",
+            options: mockbing.Options{Synthetic:3},
+            replay: true,
+            queries: []string{"cats"},
+            expected: map[string]int{},
+            failed: []string{"cats"},
+        },
+        {
+            name: "fixtures",
+            fixtures: mockbing.Fixtures{"cats": mockbing.Synthesize("fixture", 2)},
+            options: mockbing.Options{Key:"secret"},
+            queries: []string{"Cats", "dogs"},
+            expected: map[string]int{"Cats":2},
+        },
+    }
+    for _, test := range tests {
+        server := mockbing.NewServer(test.fixtures, test.options).Start()
+        client := api.NewBingClient(mockbing.Endpoint(server.URL), "secret")
+        if test.replay {
+            cassette, err := api.NewCassette(t.TempDir(), api.Replay)
+            if err != nil { t.Fatal(err) }
+            client.HTTPClient = &http.Client{Transport:cassette}
+        }
+        crawl := &Crawler{Provider:client, NumWorkers:2}
+        found := &collector{images:make(map[string][]api.ImageResult)}
+
+        err := crawl.Crawl(test.queries, t.TempDir(), found.export)
+        server.Close()
+        if failed := failedQueries(err); !reflect.DeepEqual(failed, test.failed) {
+            t.Errorf("%s: expected failed queries %v, got %v", test.name, test.failed, err)
+            continue
+        }
+        if test.replay && !errors.Is(err, api.ErrNotRecorded) {
+            t.Errorf("%s: expected %s, got %v", test.name, api.ErrNotRecorded, err)
+        }
+
+        counts := make(map[string]int)
+        for query, images := range found.images {
+            if len(images) > 0 { counts[query] = len(images) }
+            for _, image := range images {
+                if !strings.HasPrefix(image.ContentURL, server.URL + mockbing.ImagesPath) {
+                    t.Errorf("%s: link not served by the mock: %s", test.name, image.ContentURL)
+                }
+            }
+        }
+        if !reflect.DeepEqual(counts, test.expected) {
+            t.Errorf("%s: expected %v images, got %v", test.name, test.expected, counts)
+        }
+    }
+}
+
+// failedQueries lists the queries of api.QueryErrors, sorted.
+func failedQueries(err error) []string {
+    var queryErrors api.QueryErrors
+    if !errors.As(err, &queryErrors) { return nil }
+    failed := make([]string, len(queryErrors))
+    for i, queryErr := range queryErrors {
+        failed[i] = queryErr.Query
+    }
+    sort.Strings(failed)
+    return failed
+}
+
+func TestDownload(t *testing.T) {
+    type link struct { name, query string }
+    tests := []struct {
+        name string
+        links []link
+        shardSize int64
+        downloaded int
+        failed int
+        queries map[string][]string
+    }{
+        {
+            name: "images and dead links",
+            links: []link{{"a.jpg", "cats"}, {"b.png", "cats"}, {"c" + mockbing.MissingSuffix + ".jpg", "cats"}},
+            downloaded: 2,
+            failed: 1,
+            queries: map[string][]string{"a.jpg":{"cats"}, "b.png":{"cats"}},
+        },
+        {
+            name: "repeated links",
+            links: []link{{"a.jpg", "dogs"}, {"a.jpg#top", "cats"}, {"b.png", "cats"}},
+            downloaded: 2,
+            queries: map[string][]string{"a.jpg":{"cats", "dogs"}, "b.png":{"cats"}},
+        },
+        {
+            name: "shards",
+            links: []link{{"a.jpg", "cats"}, {"b.png", "dogs"}, {"a.jpg", "dogs"}, {"c" + mockbing.MissingSuffix + ".png", "dogs"}},
+            shardSize: 1 << 20,
+            downloaded: 2,
+            failed: 1,
+            queries: map[string][]string{"a.jpg":{"cats", "dogs"}, "b.png":{"dogs"}},
+        },
+    }
+    for _, test := range tests {
+        server := mockbing.NewServer(nil, mockbing.Options{}).Start()
+        records := make([]io.ImageRecord, len(test.links))
+        for i, item := range test.links {
+            records[i].ContentURL = server.URL + mockbing.ImagesPath + item.name
+            records[i].Query = item.query
+        }
+        imagesFolder := t.TempDir()
+        crawl := &Crawler{NumWorkers:2, ShardSize:test.shardSize}
+
+        err := crawl.Download("", imagesFolder, func(string) ([]io.ImageRecord, error) { return records, nil })
+        server.Close()
+        if err != nil {
+            t.Errorf("%s: unexpected error: %s", test.name, err)
+            continue
+        }
+
+        collected, err := LoadManifest(imagesFolder)
+        if err != nil {
+            t.Errorf("%s: cannot load manifest: %s", test.name, err)
+            continue
+        }
+        downloaded, failed := 0, 0
+        for _, item := range collected {
+            if item.Error != "" {
+                failed++
+                continue
+            }
+            downloaded++
+            stored := item.Filename
+            if test.shardSize > 0 { stored = item.Shard }
+            if _, err := os.Stat(stored); err != nil { t.Errorf("%s: %s is not saved: %s", test.name, item.URL, err) }
+
+            queries := test.queries[strings.TrimPrefix(item.URL, server.URL + mockbing.ImagesPath)]
+            sort.Strings(item.Queries)
+            if !reflect.DeepEqual(item.Queries, queries) {
+                t.Errorf("%s: expected queries %v of %s, got %v", test.name, queries, item.URL, item.Queries)
+            }
+            if test.shardSize > 0 {
+                packed, err := shardQueries(item)
+                if err != nil { t.Errorf("%s: cannot read %s: %s", test.name, item.Shard, err) }
+                if !reflect.DeepEqual(packed, queries) {
+                    t.Errorf("%s: expected shard queries %v of %s, got %v", test.name, queries, item.URL, packed)
+                }
+            }
+        }
+        if downloaded != test.downloaded || failed != test.failed {
+            t.Errorf("%s: expected %d downloaded and %d failed, got %d and %d",
+                test.name, test.downloaded, test.failed, downloaded, failed)
+        }
+    }
+}
+
+// shardQueries reads the queries stored in the shard next to the image.
+func shardQueries(item Downloaded) ([]string, error) {
+    file, err := os.Open(item.Shard)
+    if err != nil { return nil, err }
+    defer file.Close()
+
+    key := strings.TrimSuffix(item.Filename, path.Ext(item.Filename))
+    reader := tar.NewReader(file)
+    for {
+        header, err := reader.Next()
+        if err != nil { return nil, err }
+        if header.Name != key + ".json" { continue }
+        var sample struct { Queries []string `json:"queries"` }
+        if err = json.NewDecoder(reader).Decode(&sample); err != nil { return nil, err }
+        sort.Strings(sample.Queries)
+        return sample.Queries, nil
+    }
+}
+
+// hitCounter is a handler counting requests of every path.
+type hitCounter struct {
+    handler http.Handler
+    mu sync.Mutex
+    hits map[string]int
+}
+
+func (h *hitCounter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+    h.mu.Lock()
+    h.hits[r.URL.Path]++
+    h.mu.Unlock()
+    h.handler.ServeHTTP(w, r)
+}
+
+func TestPipeline(t *testing.T) {
+    shared := mockbing.Synthesize("shared", 2)
+    fixtures := mockbing.Fixtures{
+        "cats": append(mockbing.Synthesize("cats", 1), shared...),
+        "kittens": append(mockbing.Synthesize("kittens", 2), shared...),
+        "dogs": mockbing.Synthesize("dogs", 2),
+    }
+    tests := []struct {
+        name string
+        queries []string
+        shardSize int64
+        exported map[string]int
+        failed []string
+    }{
+        {
+            name: "shared links",
+            queries: []string{"cats", "kittens", "dogs"},
+            exported: map[string]int{"cats":3, "kittens":4, "dogs":2},
+        },
+        {
+            name: "shards",
+            queries: []string{"cats", "kittens"},
+            shardSize: 1 << 20,
+            exported: map[string]int{"cats":3, "kittens":4},
+        },
+        {
+            name: "failed query",
+            queries: []string{"cats", "kittens", "dogs"},
+            exported: map[string]int{"cats":3, "kittens":4},
+            failed: []string{"dogs"},
+        },
+    }
+    for _, test := range tests {
+        options := mockbing.Options{}
+        if test.failed != nil {
+            options.FailQueries = make(map[string]int)
+            for _, query := range test.failed {
+                options.FailQueries[query] = 500
+            }
+        }
+        counter := &hitCounter{handler:mockbing.NewServer(fixtures, options), hits:make(map[string]int)}
+        server := httptest.NewServer(counter)
+        client := api.NewBingClient(mockbing.Endpoint(server.URL), "secret")
+        crawl := &Crawler{Provider:client, NumWorkers:2, ShardSize:test.shardSize}
+        found := &collector{images:make(map[string][]api.ImageResult)}
+        imagesFolder := t.TempDir()
+
+        err := crawl.Pipeline(test.queries, t.TempDir(), imagesFolder, found.export)
+        server.Close()
+        if failed := failedQueries(err); !reflect.DeepEqual(failed, test.failed) {
+            t.Errorf("%s: expected failed queries %v, got %v", test.name, test.failed, err)
+            continue
+        }
+
+        counts := make(map[string]int)
+        expectedQueries := make(map[string][]string)
+        for query, images := range found.images {
+            counts[query] = len(images)
+            for _, image := range images {
+                expectedQueries[image.ContentURL] = append(expectedQueries[image.ContentURL], query)
+            }
+        }
+        if !reflect.DeepEqual(counts, test.exported) {
+            t.Errorf("%s: expected exported images %v, got %v", test.name, test.exported, counts)
+        }
+
+        for link := range expectedQueries {
+            imagePath := strings.TrimPrefix(link, server.URL)
+            if counter.hits[imagePath] != 1 {
+                t.Errorf("%s: expected %s to be downloaded once, got %d times", test.name, imagePath, counter.hits[imagePath])
+            }
+        }
+
+        collected, err := LoadManifest(imagesFolder)
+        if err != nil {
+            t.Errorf("%s: cannot load manifest: %s", test.name, err)
+            continue
+        }
+        if len(collected) != len(expectedQueries) {
+            t.Errorf("%s: expected %d images in manifest, got %d", test.name, len(expectedQueries), len(collected))
+        }
+        for _, item := range collected {
+            if item.Error != "" { t.Errorf("%s: %s failed: %s", test.name, item.URL, item.Error) }
+            queries := expectedQueries[item.URL]
+            sort.Strings(queries)
+            sort.Strings(item.Queries)
+            if !reflect.DeepEqual(item.Queries, queries) {
+                t.Errorf("%s: expected queries %v of %s, got %v", test.name, queries, item.URL, item.Queries)
+            }
+        }
+    }
+}
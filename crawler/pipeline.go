@@ -0,0 +1,107 @@
+package crawler
+
+import (
+    "bing/api"
+    "bing/io"
+    "context"
+    "log"
+    "os"
+    "sync"
+)
+
+// Pipeline searches for queries and downloads the found images in a single
+// pass: each page is exported into metaDataFolder with exportFunc and, at the
+// same time, its links are handed to the downloading workers, so the first
+// images are fetched while the rest of the pages are still being queried.
+// Links repeated across pages are downloaded only once. Failed queries are
+// returned as api.QueryErrors.
+func (c *Crawler) Pipeline(queries []string, metaDataFolder, imagesFolder string, exportFunc io.Exporter) error {
+    if c.Usage != nil {
+        if c.Usage.Exceeded() {
+            log.Print(c.Usage.Summary())
+            return api.ErrBudgetExceeded
+        }
+        defer func() { log.Print(c.Usage.Summary()) }()
+    }
+
+    if metaDataFolder != io.Stdout {
+        if err := os.MkdirAll(metaDataFolder, os.ModePerm); err != nil { return err }
+    }
+    downloadedFolder, shards, err := c.prepareImages(imagesFolder)
+    if err != nil { return err }
+    if shards != nil { defer shards.Close() }
+
+    queriesQueue := make(chan string)
+    resultsQueue := make(chan result, 10)
+    exportQueue := make(chan result, 10)
+    feed := make(chan task, c.NumWorkers)
+    downloads := make(chan Downloaded)
+
+    go enqueueStrings(queries, queriesQueue)
+
+    ctx, cancel := context.WithCancel(context.Background())
+    defer cancel()
+    failed := &failures{cancel:cancel}
+
+    var queryGroup sync.WaitGroup
+    for i := 1; i <= c.NumWorkers; i++ {
+        queryGroup.Add(1)
+        go queryWorker(ctx, i, queriesQueue, resultsQueue, &queryGroup, c.Provider)
+    }
+    go func() {
+        queryGroup.Wait()
+        log.Printf("all queries are done, closing results queue")
+        close(resultsQueue)
+    }()
+
+    links := io.NewURLSet()
+    go dispatch(resultsQueue, exportQueue, feed, links)
+
+    var writerGroup sync.WaitGroup
+    for i := 1; i <= c.NumWorkers; i++ {
+        writerGroup.Add(1)
+        go writingWorker(i, metaDataFolder, exportQueue, &writerGroup, exportFunc, failed)
+    }
+
+    var downloadGroup sync.WaitGroup
+    for i := 1; i <= c.NumWorkers; i++ {
+        downloadGroup.Add(1)
+        go downloadingWorker(i, downloadedFolder, shards, c.downloadTimeout(), feed, downloads, &downloadGroup)
+    }
+    go func() {
+        downloadGroup.Wait()
+        log.Printf("all downloaders were terminated, closing results channel")
+        close(downloads)
+    }()
+
+    collected := make([]Downloaded, 0)
+    for downloaded := range downloads {
+        c.record(downloaded)
+        collected = append(collected, downloaded)
+    }
+    writerGroup.Wait()
+
+    // a link could be found by more queries after it was sent to download, so
+    // only the manifest has all of them
+    if err = finishDownloads(imagesFolder, collected, links, shards); err != nil { return err }
+    log.Printf("query results are saved into folder: %s", metaDataFolder)
+    log.Printf("collected images are saved into folder: %s", imagesFolder)
+    return failed.err()
+}
+
+// dispatch forwards each page to the exporting queue and its new links to the
+// downloading queue; both queues are closed when the pages are over.
+func dispatch(in <-chan result, export chan<- result, feed chan<- task, links *io.URLSet) {
+    defer close(feed)
+    defer close(export)
+    for page := range in {
+        export <- page
+        if page.err != nil { continue }
+        query := page.collection.Query
+        for _, image := range page.collection.Values {
+            if links.Add(image.ContentURL, query) {
+                feed <- task{ImageRecord:io.ImageRecord{ImageResult:image, Query:query}, Queries:[]string{query}}
+            }
+        }
+    }
+}
@@ -4,7 +4,8 @@ import (
     "bing/api"
     "bing/io"
     "bing/utils"
-    "fmt"
+    "context"
+    "errors"
     "log"
     "path"
     "sync"
@@ -12,37 +13,37 @@ import (
 )
 
 // queryWorker performs REST API queries taking search strings from in channel, and saving
-// results into out channel.
+// results into out channel. Queries left after ctx is cancelled are skipped.
 func queryWorker(
+    ctx context.Context,
     workerIndex int,
     in <-chan string,
     out chan<- result,
     group *sync.WaitGroup,
-    client *api.BingClient) {
+    provider api.SearchProvider) {
 
     defer group.Done()
 
     for queryString := range in {
-        if queryString == "" { continue }
+        if queryString == "" || ctx.Err() != nil { continue }
         log.Printf("[worker:%d] sending search string: %s", workerIndex, queryString)
 
         currOffset := 0
         running := true
-        var err error
         for running {
             params := api.CreateQuery(queryString, currOffset)
             paramsString := params.AsQueryParameters()
             log.Printf("[worker:%d] running query with params: %s", workerIndex, paramsString)
-            images := client.RequestImages(params)
-            if images.Values == nil {
-                err = fmt.Errorf("[worker:%d] failed to pull query: %s/%s",
-                    workerIndex, client.Endpoint, paramsString)
+            images, err := provider.RequestPage(ctx, params)
+            if err != nil {
+                log.Printf("[worker:%d] failed to pull query: %s/%s: %s",
+                    workerIndex, provider.Name(), paramsString, err)
                 running = false
             } else {
                 running = images.NextOffset != currOffset
                 currOffset = images.NextOffset
             }
-            out <- result{images, err}
+            out <- result{queryString, images, err}
         }
     }
 
@@ -50,58 +51,112 @@ func queryWorker(
 }
 
 // writingWorker takes JSON structures from in channel and saves them onto disk.
+// Failed queries and pages are reported into failed.
 func writingWorker(
     workerIndex int,
     outputFolder string,
     in <-chan result,
     group *sync.WaitGroup,
-    exportFunc io.Exporter) {
+    exportFunc io.Exporter,
+    failed *failures) {
 
     defer group.Done()
 
     for result := range in {
-        outputFile := path.Join(outputFolder, utils.SimpleRandomString(20))
-        log.Printf("[worker:%d] saving file %s", workerIndex, outputFile)
         if result.err != nil {
-            log.Printf(result.err.Error())
-        } else {
-            query := result.collection.Query
-            log.Printf(
-                "[worker:%d] exporting query results for '%s' into file '%s",
-                workerIndex, query, outputFile)
-            if err := exportFunc(result.collection, outputFile); err != nil {
-                log.Printf(err.Error())
-            }
+            failed.add(result.query, result.err)
+            continue
+        }
+        outputFile := path.Join(outputFolder, utils.SimpleRandomString(20))
+        log.Printf(
+            "[worker:%d] exporting query results for '%s' into file '%s",
+            workerIndex, result.query, outputFile)
+        if err := exportFunc(result.collection, outputFile); err != nil {
+            log.Printf("[worker:%d] cannot export query results for '%s': %s", workerIndex, result.query, err)
+            failed.add(result.query, err)
         }
     }
 
     log.Printf("[worker:%d] terminated", workerIndex)
 }
 
-// downloadingWorker performs actual work of retrieving the images and saving them onto local disk.
+// failures collects the queries failed during a crawl. Errors no other query
+// gets past, a missing cassette record or an exhausted budget, cancel the crawl.
+type failures struct {
+    mu sync.Mutex
+    errors api.QueryErrors
+    cancel context.CancelFunc
+}
+
+func (f *failures) add(query string, err error) {
+    f.mu.Lock()
+    defer f.mu.Unlock()
+    // queries interrupted by the cancellation aren't failures on their own
+    if errors.Is(err, context.Canceled) { return }
+    f.errors = append(f.errors, api.QueryError{Query:query, Err:err})
+    if errors.Is(err, api.ErrNotRecorded) || errors.Is(err, api.ErrBudgetExceeded) {
+        log.Printf("stopping the crawl: %s", err)
+        f.cancel()
+    }
+}
+
+// err returns the collected failures as api.QueryErrors, or nil if none.
+func (f *failures) err() error {
+    f.mu.Lock()
+    defer f.mu.Unlock()
+    if len(f.errors) == 0 { return nil }
+    return f.errors
+}
+
+// downloadingWorker performs actual work of retrieving the images and saving them onto local disk,
+// either into imagesFolder or, if shards are given, into tar shards.
 func downloadingWorker(
     workerIndex int,
     imagesFolder string,
-    urls <-chan string,
+    shards *io.ShardWriter,
+    timeout time.Duration,
+    images <-chan task,
     results chan<- Downloaded,
     group *sync.WaitGroup) {
 
     defer group.Done()
 
-    fetcher := io.NewImageFetcher(1*time.Hour)
-    for url := range urls {
-        log.Printf("[worker:%d] fetching URL: %s", workerIndex, url)
-        outputFile := path.Join(imagesFolder, utils.SimpleRandomString(20))
-        createdFile, err := fetcher.Fetch(url, outputFile)
+    fetcher := io.NewImageFetcher(timeout)
+    for image := range images {
+        log.Printf("[worker:%d] fetching URL: %s", workerIndex, image.ContentURL)
+        downloaded := Downloaded{
+            URL: image.ContentURL,
+            Width: image.Width,
+            Height: image.Height,
+            Format: image.EncodingFormat,
+        }
+        var err error
+        if shards != nil {
+            downloaded.Shard, downloaded.Filename, err = fetchIntoShard(fetcher, shards, image)
+        } else {
+            outputFile := path.Join(imagesFolder, utils.SimpleRandomString(20))
+            downloaded.Filename, err = fetcher.Fetch(image.ContentURL, outputFile, image.EncodingFormat)
+        }
         if err != nil {
             log.Printf("[worker:%d] %s", workerIndex, err.Error())
+            downloaded.Error = err.Error()
         }
-        results <- Downloaded{URL:url, Filename:createdFile, Error:err}
+        results <- downloaded
     }
 
     log.Printf("[worker:%d] terminated", workerIndex)
 }
 
+// fetchIntoShard downloads the image and adds it to shards together with its
+// metadata, returning the shard and the name of the image in it.
+func fetchIntoShard(fetcher *io.ImageFetcher, shards *io.ShardWriter, image task) (string, string, error) {
+    data, ext, err := fetcher.FetchBytes(image.ContentURL, image.EncodingFormat)
+    if err != nil { return "", "", err }
+    shard, key, err := shards.Write(ext, data, image)
+    if err != nil { return "", "", err }
+    return shard, key + "." + ext, nil
+}
+
 // enqueueStrings sends strings into channel, and closes it.
 func enqueueStrings(strings []string, channel chan<- string) {
     for _, item := range strings {
@@ -109,3 +164,11 @@ func enqueueStrings(strings []string, channel chan<- string) {
     }
     close(channel)
 }
+
+// enqueueTasks sends images into channel, and closes it.
+func enqueueTasks(tasks []task, channel chan<- task) {
+    for _, item := range tasks {
+        channel <- item
+    }
+    close(channel)
+}
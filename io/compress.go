@@ -0,0 +1,185 @@
+package io
+
+import (
+    "bing/utils"
+    "compress/gzip"
+    "fmt"
+    "io"
+    "io/ioutil"
+    "os"
+    "strings"
+
+    "github.com/klauspost/compress/zstd"
+)
+
+// Compression is a codec applied to exported files. A nil *Compression means
+// the files are written as is.
+type Compression struct {
+    Name string
+    // Extension is appended to the names of compressed files, like ".gz".
+    Extension string
+    newWriter func(w io.Writer) (io.WriteCloser, error)
+    newReader func(r io.Reader) (io.ReadCloser, error)
+}
+
+var compressions = []*Compression{
+    {
+        Name: "gzip",
+        Extension: ".gz",
+        newWriter: func(w io.Writer) (io.WriteCloser, error) { return gzip.NewWriter(w), nil },
+        newReader: func(r io.Reader) (io.ReadCloser, error) { return gzip.NewReader(r) },
+    },
+    {
+        Name: "zstd",
+        Extension: ".zst",
+        newWriter: func(w io.Writer) (io.WriteCloser, error) { return zstd.NewWriter(w) },
+        newReader: func(r io.Reader) (io.ReadCloser, error) {
+            decoder, err := zstd.NewReader(r)
+            if err != nil { return nil, err }
+            return decoder.IOReadCloser(), nil
+        },
+    },
+}
+
+// LookupCompression returns the compression named "gzip" or "zstd"; an empty
+// name or "none" means no compression.
+func LookupCompression(name string) (*Compression, error) {
+    if name == "" || name == "none" { return nil, nil }
+    for _, compression := range compressions {
+        if compression.Name == name { return compression, nil }
+    }
+    return nil, fmt.Errorf("unknown compression '%s', expected 'gzip' or 'zstd'", name)
+}
+
+// DetectCompression returns the compression of fileName by its extension, and
+// the name without it.
+func DetectCompression(fileName string) (*Compression, string) {
+    for _, compression := range compressions {
+        if strings.HasSuffix(fileName, compression.Extension) {
+            return compression, strings.TrimSuffix(fileName, compression.Extension)
+        }
+    }
+    return nil, fileName
+}
+
+// Ext returns the extension of compressed files, empty for no compression.
+func (c *Compression) Ext() string {
+    if c == nil { return "" }
+    return c.Extension
+}
+
+// compressedFile writes into a file through the compression codec.
+type compressedFile struct {
+    io.Writer
+    codec io.WriteCloser
+    file outputFile
+}
+
+// outputFile is the file a compressedFile writes into: committing keeps the
+// written data, aborting drops what it can.
+type outputFile interface {
+    io.Writer
+    Commit() error
+    Abort() error
+}
+
+// appendedFile adds data to the end of a file in place, so the data of a long
+// run written so far stays there if the run is interrupted.
+type appendedFile struct {
+    *os.File
+}
+
+func (f appendedFile) Commit() error {
+    if err := f.Sync(); err != nil {
+        _ = f.Close()
+        return err
+    }
+    return f.Close()
+}
+
+// Abort closes the file; the data already appended can't be taken back.
+func (f appendedFile) Abort() error {
+    return f.Close()
+}
+
+// createFile starts writing fileName, compressing the data written into it. If
+// appending, the data is added to the end of the file in place; otherwise it
+// goes into a temporary file, moved in place when the returned writer is
+// closed and dropped when it is aborted.
+func createFile(fileName string, appending bool, compression *Compression) (*compressedFile, error) {
+    var file outputFile
+    if appending {
+        appended, err := os.OpenFile(fileName, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+        if err != nil { return nil, err }
+        file = appendedFile{appended}
+    } else {
+        atomic, err := utils.CreateAtomic(fileName)
+        if err != nil { return nil, err }
+        file = atomic
+    }
+    if compression == nil { return &compressedFile{Writer:file, file:file}, nil }
+
+    codec, err := compression.newWriter(file)
+    if err != nil {
+        _ = file.Abort()
+        return nil, err
+    }
+    return &compressedFile{Writer:codec, codec:codec, file:file}, nil
+}
+
+func (f *compressedFile) Close() error {
+    if f.codec != nil {
+        if err := f.codec.Close(); err != nil {
+            _ = f.file.Abort()
+            return err
+        }
+    }
+    return f.file.Commit()
+}
+
+func (f *compressedFile) Abort() error {
+    return f.file.Abort()
+}
+
+// decompressedFile reads a file through the compression codec.
+type decompressedFile struct {
+    io.Reader
+    codec io.ReadCloser
+    file *os.File
+}
+
+// openFile opens fileName for reading, decompressing it if its extension
+// tells it is compressed.
+func openFile(fileName string) (io.ReadCloser, error) {
+    file, err := os.Open(fileName)
+    if err != nil { return nil, err }
+    compression, _ := DetectCompression(fileName)
+    if compression == nil { return file, nil }
+
+    codec, err := compression.newReader(file)
+    if err != nil {
+        _ = file.Close()
+        return nil, fmt.Errorf("cannot decompress %s: %s", fileName, err)
+    }
+    return &decompressedFile{Reader:codec, codec:codec, file:file}, nil
+}
+
+func (f *decompressedFile) Close() error {
+    _ = f.codec.Close()
+    return f.file.Close()
+}
+
+// readFile reads the whole fileName, decompressing it if needed.
+func readFile(fileName string) ([]byte, error) {
+    f, err := openFile(fileName)
+    if err != nil { return nil, err }
+    defer f.Close()
+    return ioutil.ReadAll(f)
+}
+
+// hasExtension tells if fileName has extension, maybe followed by the one of
+// a compression.
+func hasExtension(fileName, extension string) bool {
+    _, name := DetectCompression(fileName)
+    return strings.HasSuffix(name, extension)
+}
@@ -0,0 +1,116 @@
+package io
+
+import (
+    "bing/api"
+    "io/ioutil"
+    "path"
+    "sort"
+    "strconv"
+    "strings"
+    "testing"
+)
+
+func TestCompressedFormats(t *testing.T) {
+    gzip, _ := LookupCompression("gzip")
+    zstd, _ := LookupCompression("zstd")
+    tests := []struct {
+        format string
+        compression *Compression
+        extension string
+    }{
+        {"json", nil, ".json"},
+        {"json", gzip, ".json.gz"},
+        {"json", zstd, ".json.zst"},
+        {"jsonl", nil, ".jsonl"},
+        {"jsonl", gzip, ".jsonl.gz"},
+        {"jsonl", zstd, ".jsonl.zst"},
+    }
+    for _, test := range tests {
+        name := test.format + test.compression.Ext()
+        folder := t.TempDir()
+        format, err := LookupFormat(test.format)
+        if err != nil { t.Fatal(err) }
+        output, err := format.Open(folder, test.compression)
+        if err != nil { t.Fatalf("%s: %s", name, err) }
+        collections := []*api.ImagesCollection{csvCollection("cats", 2), csvCollection("dogs", 3)}
+        for i, collection := range collections {
+            if err = output.Export(collection, path.Join(folder, "page" + strconv.Itoa(i))); err != nil { t.Fatalf("%s: %s", name, err) }
+        }
+        if err = output.Close(); err != nil { t.Fatalf("%s: %s", name, err) }
+
+        files, err := ioutil.ReadDir(folder)
+        if err != nil { t.Fatal(err) }
+        for _, file := range files {
+            if !strings.HasSuffix(file.Name(), test.extension) {
+                t.Errorf("%s: expected %s extension, got %s", name, test.extension, file.Name())
+            }
+        }
+        detected, err := DetectFormat(folder)
+        if err != nil || detected.Name != test.format {
+            t.Errorf("%s: expected %s format detected, got %q: %v", name, test.format, detected.Name, err)
+        }
+
+        records, err := format.Import(folder)
+        if err != nil { t.Fatalf("%s: %s", name, err) }
+        var imported, expected []string
+        for _, record := range records {
+            imported = append(imported, record.Query + " " + record.ContentURL)
+        }
+        for _, collection := range collections {
+            for _, image := range collection.Values {
+                expected = append(expected, collection.Query + " " + image.ContentURL)
+            }
+        }
+        sort.Strings(imported)
+        sort.Strings(expected)
+        if strings.Join(imported, "\n") != strings.Join(expected, "\n") {
+            t.Errorf("%s: expected records %v, got %v", name, expected, imported)
+        }
+    }
+}
+
+func TestAppendedStreams(t *testing.T) {
+    for _, name := range []string{"none", "gzip", "zstd"} {
+        compression, err := LookupCompression(name)
+        if err != nil { t.Fatal(err) }
+        fileName := path.Join(t.TempDir(), "stream.txt" + compression.Ext())
+        for _, chunk := range []string{"first\n", "second\n", "third\n"} {
+            f, err := createFile(fileName, true, compression)
+            if err != nil { t.Fatalf("%s: %s", name, err) }
+            if _, err = f.Write([]byte(chunk)); err != nil { t.Fatalf("%s: %s", name, err) }
+            if err = f.Close(); err != nil { t.Fatalf("%s: %s", name, err) }
+        }
+
+        data, err := readFile(fileName)
+        if err != nil { t.Fatalf("%s: %s", name, err) }
+        if string(data) != "first\nsecond\nthird\n" {
+            t.Errorf("%s: expected all the appended members, got %q", name, data)
+        }
+    }
+}
+
+func TestDetectCompressedFormat(t *testing.T) {
+    tests := []struct {
+        fileName string
+        expected string
+    }{
+        {"page.json.gz", "json"},
+        {"page.json.zst", "json"},
+        {"results.jsonl.zst", "jsonl"},
+        {"results.jsonl.gz", "jsonl"},
+        {"results.csv.gz", "csv"},
+        {"results.jsonl", "jsonl"},
+        {"notes.txt.gz", ""},
+    }
+    folder := t.TempDir()
+    for _, test := range tests {
+        fileName := path.Join(folder, test.fileName)
+        if err := ioutil.WriteFile(fileName, nil, 0644); err != nil { t.Fatal(err) }
+        format, err := DetectFormat(fileName)
+        if test.expected == "" {
+            if err == nil { t.Errorf("%s: expected no format, got %s", test.fileName, format.Name) }
+        } else if err != nil || format.Name != test.expected {
+            t.Errorf("%s: expected %s format, got %q: %v", test.fileName, test.expected, format.Name, err)
+        }
+    }
+}
@@ -0,0 +1,212 @@
+package io
+
+import (
+    "bing/api"
+    "bing/utils"
+    "encoding/csv"
+    "fmt"
+    "io"
+    "log"
+    "os"
+    "path/filepath"
+    "strconv"
+    "strings"
+    "sync"
+)
+
+// csvFields maps CSV column names to the values of an image found by a query.
+// The names are the same as JSON field names, so importers can use either format.
+var csvFields = map[string]func(query string, image api.ImageResult) string {
+    "query": func(query string, _ api.ImageResult) string { return query },
+    "name": func(_ string, image api.ImageResult) string { return image.Name },
+    "imageId": func(_ string, image api.ImageResult) string { return image.ImageID },
+    "contentUrl": func(_ string, image api.ImageResult) string { return image.ContentURL },
+    "hostPageUrl": func(_ string, image api.ImageResult) string { return image.HostPageURL },
+    "webSearchUrl": func(_ string, image api.ImageResult) string { return image.WebSearchURL },
+    "width": func(_ string, image api.ImageResult) string { return strconv.Itoa(image.Width) },
+    "height": func(_ string, image api.ImageResult) string { return strconv.Itoa(image.Height) },
+    "encodingFormat": func(_ string, image api.ImageResult) string { return image.EncodingFormat },
+    "contentSize": func(_ string, image api.ImageResult) string { return image.ContentSize },
+    "accentColor": func(_ string, image api.ImageResult) string { return image.AccentColor },
+}
+
+// DefaultCSVColumns covers the full image result schema.
+var DefaultCSVColumns = []string {
+    "query",
+    "name",
+    "imageId",
+    "contentUrl",
+    "hostPageUrl",
+    "webSearchUrl",
+    "width",
+    "height",
+    "encodingFormat",
+    "contentSize",
+    "accentColor",
+}
+
+// NewCSVExporter returns an Exporter writing the given columns, compressed
+// with compression. Rows are appended to the output file, which must have the
+// same columns; the header is written when the file is created.
+func NewCSVExporter(columns []string, compression *Compression) (Exporter, error) {
+    if err := checkCSVColumns(columns); err != nil { return nil, err }
+
+    return func(collection *api.ImagesCollection, outputFile string) error {
+        export, closeFunc, err := NewCSVFileExporter(outputFile + ".csv" + compression.Ext(), columns, compression, true)
+        if err != nil { return err }
+        if err = export(collection, ""); err != nil { return err }
+        return closeFunc()
+    }, nil
+}
+
+// NewCSVFileExporter returns an Exporter writing the rows of all the pages
+// into a single fileName, ignoring the output file names of the pages,
+// together with the function flushing the file once the export is over. If
+// appending, the rows are added in place after the ones already in fileName,
+// which must have the same columns; otherwise they go into a temporary file
+// replacing fileName when the export is over.
+func NewCSVFileExporter(fileName string, columns []string, compression *Compression, appending bool) (Exporter, func() error, error) {
+    if err := checkCSVColumns(columns); err != nil { return nil, nil, err }
+    newFile := true
+    if appending {
+        header, err := readCSVHeader(fileName)
+        if err != nil { return nil, nil, err }
+        if header != nil && strings.Join(header, ",") != strings.Join(columns, ",") {
+            return nil, nil, fmt.Errorf("cannot append columns %s to %s with columns %s",
+                strings.Join(columns, ","), fileName, strings.Join(header, ","))
+        }
+        newFile = header == nil
+    }
+
+    // compressed streams appended to each other are read as a single one
+    f, err := createFile(fileName, appending, compression)
+    if err != nil { return nil, nil, err }
+
+    var mu sync.Mutex
+    var failed error
+    writer := csv.NewWriter(f)
+    if newFile { _ = writer.Write(columns) }
+
+    export := func(collection *api.ImagesCollection, _ string) error {
+        mu.Lock()
+        defer mu.Unlock()
+        row := make([]string, len(columns))
+        for _, image := range collection.Values {
+            for i, column := range columns {
+                row[i] = csvFields[column](collection.Query, image)
+            }
+            _ = writer.Write(row)
+        }
+        writer.Flush()
+        if err := writer.Error(); err != nil && failed == nil { failed = err }
+        return failed
+    }
+    closeFunc := func() error {
+        mu.Lock()
+        defer mu.Unlock()
+        writer.Flush()
+        if err := writer.Error(); err != nil && failed == nil { failed = err }
+        if failed != nil {
+            _ = f.Abort()
+            return failed
+        }
+        return f.Close()
+    }
+    return export, closeFunc, nil
+}
+
+// readCSVHeader returns the columns of an existing CSV file, nil if the file
+// is missing or empty.
+func readCSVHeader(fileName string) ([]string, error) {
+    f, err := openFile(fileName)
+    if os.IsNotExist(err) { return nil, nil }
+    if err != nil { return nil, err }
+    defer utils.SilentClose(f)
+
+    header, err := csv.NewReader(f).Read()
+    if err == io.EOF { return nil, nil }
+    if err != nil { return nil, fmt.Errorf("cannot read header of %s: %s", fileName, err) }
+    return header, nil
+}
+
+func checkCSVColumns(columns []string) error {
+    if len(columns) == 0 { return fmt.Errorf("no CSV columns specified") }
+    for _, column := range columns {
+        if _, ok := csvFields[column]; !ok { return fmt.Errorf("unknown CSV column: %s", column) }
+    }
+    return nil
+}
+
+// ToCSV saves the collected information about images with all the columns to
+// use it later for downloading.
+func ToCSV(collection *api.ImagesCollection, outputFile string) error {
+    export, _ := NewCSVExporter(DefaultCSVColumns, nil)
+    return export(collection, outputFile)
+}
+
+// csvParsers set the fields of a record from CSV columns; the unknown columns
+// are ignored.
+var csvParsers = map[string]func(record *ImageRecord, value string) error {
+    "query": func(record *ImageRecord, value string) error { record.Query = value; return nil },
+    "name": func(record *ImageRecord, value string) error { record.Name = value; return nil },
+    "imageId": func(record *ImageRecord, value string) error { record.ImageID = value; return nil },
+    "contentUrl": func(record *ImageRecord, value string) error { record.ContentURL = value; return nil },
+    "hostPageUrl": func(record *ImageRecord, value string) error { record.HostPageURL = value; return nil },
+    "webSearchUrl": func(record *ImageRecord, value string) error { record.WebSearchURL = value; return nil },
+    "width": func(record *ImageRecord, value string) (err error) { record.Width, err = parseSize(value); return },
+    "height": func(record *ImageRecord, value string) (err error) { record.Height, err = parseSize(value); return },
+    "encodingFormat": func(record *ImageRecord, value string) error { record.EncodingFormat = value; return nil },
+    "contentSize": func(record *ImageRecord, value string) error { record.ContentSize = value; return nil },
+    "accentColor": func(record *ImageRecord, value string) error { record.AccentColor = value; return nil },
+}
+
+// FromCSV loads the images from a CSV file, or a folder with CSV files,
+// written by a CSV exporter. The files need a contentUrl column.
+func FromCSV(outputFolder string) ([]ImageRecord, error) {
+    records := make([]ImageRecord, 0)
+    err := filepath.Walk(outputFolder, func(path string, info os.FileInfo, err error) error {
+        if err != nil { return err }
+        if !hasExtension(path, ".csv") { return nil }
+
+        f, err := openFile(path)
+        if err != nil { return err }
+        defer f.Close()
+
+        reader := csv.NewReader(f)
+        header, err := reader.Read()
+        if err != nil { return fmt.Errorf("cannot read header of %s: %s", path, err) }
+        hasURL := false
+        for _, column := range header {
+            if column == "contentUrl" { hasURL = true }
+        }
+        if !hasURL { return fmt.Errorf("%s has no column 'contentUrl'", path) }
+
+        for {
+            row, err := reader.Read()
+            if err == io.EOF { break }
+            if err != nil { return fmt.Errorf("cannot read %s: %s", path, err) }
+            line, _ := reader.FieldPos(0)
+
+            record := ImageRecord{Source:path}
+            for i, column := range header {
+                parse, ok := csvParsers[column]
+                if !ok { continue }
+                if err = parse(&record, row[i]); err != nil {
+                    return fmt.Errorf("%s:%d: invalid %s: %s", path, line, column, err)
+                }
+            }
+            if record.ContentURL == "" { return fmt.Errorf("%s:%d: empty contentUrl", path, line) }
+            records = append(records, record)
+        }
+        return nil
+    })
+    if err != nil { return nil, err }
+    log.Printf("loaded %d images from %s", len(records), outputFolder)
+    return records, nil
+}
+
+// parseSize reads image width or height, which is allowed to be blank.
+func parseSize(value string) (int, error) {
+    if value == "" { return 0, nil }
+    return strconv.Atoi(value)
+}
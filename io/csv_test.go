@@ -0,0 +1,108 @@
+package io
+
+import (
+    "bing/api"
+    "path"
+    "strings"
+    "testing"
+)
+
+func csvCollection(query string, count int) *api.ImagesCollection {
+    collection := &api.ImagesCollection{Query:query}
+    for i := 0; i < count; i++ {
+        collection.Values = append(collection.Values, api.ImageResult{
+            Name: "a \"quoted\", name\nwith a line break",
+            ImageID: strings.Repeat("f", i + 1),
+            ContentURL: "http://example.com/" + query + "/" + strings.Repeat("x", i + 1) + ".jpg",
+            HostPageURL: "http://example.com/page?a=1,b=2",
+            Width: 640 + i,
+            Height: 480,
+            EncodingFormat: "jpeg",
+            ContentSize: "1024 B",
+            AccentColor: "FFAA00",
+        })
+    }
+    return collection
+}
+
+func exportCSV(t *testing.T, fileName string, columns []string, compression *Compression, appending bool,
+    collections ...*api.ImagesCollection) error {
+
+    export, closeFunc, err := NewCSVFileExporter(fileName, columns, compression, appending)
+    if err != nil { return err }
+    for _, collection := range collections {
+        if err = export(collection, ""); err != nil { t.Fatal(err) }
+    }
+    return closeFunc()
+}
+
+func TestCSVRoundTrip(t *testing.T) {
+    gzip, _ := LookupCompression("gzip")
+    tests := []struct {
+        name string
+        columns []string
+        compression *Compression
+    }{
+        {"all columns", DefaultCSVColumns, nil},
+        {"compressed", DefaultCSVColumns, gzip},
+        {"some columns", []string{"contentUrl", "query", "width"}, nil},
+    }
+    for _, test := range tests {
+        fileName := path.Join(t.TempDir(), "export.csv" + test.compression.Ext())
+        collections := []*api.ImagesCollection{csvCollection("cats", 2), csvCollection("red dogs", 3)}
+        if err := exportCSV(t, fileName, test.columns, test.compression, false, collections...); err != nil {
+            t.Fatalf("%s: %s", test.name, err)
+        }
+
+        records, err := FromCSV(fileName)
+        if err != nil { t.Fatalf("%s: %s", test.name, err) }
+        expected := make([]ImageRecord, 0)
+        for _, collection := range collections {
+            for _, image := range collection.Values {
+                record := ImageRecord{Query:collection.Query, Source:fileName}
+                for _, column := range test.columns {
+                    _ = csvParsers[column](&record, csvFields[column](collection.Query, image))
+                }
+                expected = append(expected, record)
+            }
+        }
+        if len(records) != len(expected) {
+            t.Fatalf("%s: expected %d records, got %d", test.name, len(expected), len(records))
+        }
+        for i := range records {
+            if records[i] != expected[i] {
+                t.Errorf("%s: record %d: expected %+v, got %+v", test.name, i, expected[i], records[i])
+            }
+        }
+    }
+}
+
+func TestCSVAppend(t *testing.T) {
+    fileName := path.Join(t.TempDir(), "export.csv")
+    columns := []string{"query", "contentUrl"}
+    if err := exportCSV(t, fileName, columns, nil, false, csvCollection("cats", 2)); err != nil { t.Fatal(err) }
+
+    tests := []struct {
+        name string
+        columns []string
+        appending bool
+        expected int
+        fails bool
+    }{
+        {"replace", columns, false, 2, false},
+        {"append", columns, true, 4, false},
+        {"append other columns", []string{"contentUrl", "query"}, true, 4, true},
+        {"replace with other columns", []string{"contentUrl"}, false, 2, false},
+    }
+    for _, test := range tests {
+        err := exportCSV(t, fileName, test.columns, nil, test.appending, csvCollection("dogs", 2))
+        if test.fails != (err != nil) {
+            t.Fatalf("%s: unexpected result: %v", test.name, err)
+        }
+        records, err := FromCSV(fileName)
+        if err != nil { t.Fatalf("%s: %s", test.name, err) }
+        if len(records) != test.expected {
+            t.Errorf("%s: expected %d records, got %d", test.name, test.expected, len(records))
+        }
+    }
+}
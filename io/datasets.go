@@ -0,0 +1,223 @@
+package io
+
+import (
+    "bing/utils"
+    "encoding/csv"
+    "encoding/json"
+    "encoding/xml"
+    "sort"
+    "strconv"
+    "time"
+)
+
+// LabeledImage is a downloaded image described for labeling tools.
+type LabeledImage struct {
+    // Path is relative to the images folder.
+    Path string
+    // Label is the query that found the image.
+    Label string
+    URL string
+    Width int
+    Height int
+    License string
+}
+
+// DatasetExporter writes downloaded images into fileName in a format some
+// labeling tool imports.
+type DatasetExporter func(images []LabeledImage, fileName string) error
+
+// DatasetFormat is a dataset exporter with the default name of its file.
+type DatasetFormat struct {
+    FileName string
+    Export DatasetExporter
+}
+
+// DatasetFormats lists the supported dataset formats by name.
+var DatasetFormats = map[string]DatasetFormat {
+    "coco": {FileName:"coco.json", Export:ToCOCO},
+    "label-studio": {FileName:"label-studio.json", Export:ToLabelStudio},
+    "cvat": {FileName:"cvat.xml", Export:ToCVAT},
+    "manifest": {FileName:"manifest.csv", Export:ToManifestCSV},
+}
+
+// LabelStudioPrefix turns image paths into links served by Label Studio from
+// local storage; its document root should be the images folder.
+var LabelStudioPrefix = "/data/local-files/?d="
+
+// labels returns sorted unique labels of images.
+func labels(images []LabeledImage) []string {
+    seen := make(map[string]bool)
+    result := make([]string, 0)
+    for _, image := range images {
+        if !seen[image.Label] {
+            seen[image.Label] = true
+            result = append(result, image.Label)
+        }
+    }
+    sort.Strings(result)
+    return result
+}
+
+func writeJSON(fileName string, value interface{}) error {
+    data, err := json.MarshalIndent(value, "", " ")
+    if err != nil { return err }
+    return utils.WriteFileAtomic(fileName, data)
+}
+
+type cocoDataset struct {
+    Info cocoInfo                 `json:"info"`
+    Licenses []cocoLicense        `json:"licenses"`
+    Images []cocoImage            `json:"images"`
+    Categories []cocoCategory     `json:"categories"`
+    Annotations []json.RawMessage `json:"annotations"`
+}
+
+type cocoInfo struct {
+    Description string `json:"description"`
+    DateCreated string `json:"date_created"`
+}
+
+type cocoLicense struct {
+    ID int      `json:"id"`
+    Name string `json:"name"`
+    URL string  `json:"url"`
+}
+
+type cocoImage struct {
+    ID int          `json:"id"`
+    FileName string `json:"file_name"`
+    Width int       `json:"width"`
+    Height int      `json:"height"`
+    License int     `json:"license,omitempty"`
+    CocoURL string  `json:"coco_url"`
+}
+
+type cocoCategory struct {
+    ID int      `json:"id"`
+    Name string `json:"name"`
+}
+
+// ToCOCO writes images in COCO format. The queries become categories; there
+// are no annotations, as nothing is labeled yet.
+func ToCOCO(images []LabeledImage, fileName string) error {
+    dataset := cocoDataset{
+        Info: cocoInfo{Description:"images collected by search queries", DateCreated:time.Now().Format(time.RFC3339)},
+        Licenses: make([]cocoLicense, 0),
+        Images: make([]cocoImage, 0, len(images)),
+        Categories: make([]cocoCategory, 0),
+        Annotations: make([]json.RawMessage, 0),
+    }
+    for i, label := range labels(images) {
+        dataset.Categories = append(dataset.Categories, cocoCategory{ID:i + 1, Name:label})
+    }
+    licenses := make(map[string]int)
+    for i, image := range images {
+        item := cocoImage{ID:i + 1, FileName:image.Path, Width:image.Width, Height:image.Height, CocoURL:image.URL}
+        if image.License != "" {
+            if _, ok := licenses[image.License]; !ok {
+                licenses[image.License] = len(licenses) + 1
+                dataset.Licenses = append(dataset.Licenses, cocoLicense{ID:licenses[image.License], Name:image.License})
+            }
+            item.License = licenses[image.License]
+        }
+        dataset.Images = append(dataset.Images, item)
+    }
+    return writeJSON(fileName, dataset)
+}
+
+type labelStudioTask struct {
+    Data labelStudioData `json:"data"`
+}
+
+type labelStudioData struct {
+    Image string `json:"image"`
+    URL string   `json:"url"`
+    Query string `json:"query"`
+}
+
+// ToLabelStudio writes images as Label Studio tasks, with the query kept in
+// task data.
+func ToLabelStudio(images []LabeledImage, fileName string) error {
+    tasks := make([]labelStudioTask, 0, len(images))
+    for _, image := range images {
+        tasks = append(tasks, labelStudioTask{labelStudioData{
+            Image: LabelStudioPrefix + image.Path,
+            URL: image.URL,
+            Query: image.Label,
+        }})
+    }
+    return writeJSON(fileName, tasks)
+}
+
+type cvatAnnotations struct {
+    XMLName xml.Name    `xml:"annotations"`
+    Version string      `xml:"version"`
+    Meta cvatMeta       `xml:"meta"`
+    Images []cvatImage  `xml:"image"`
+}
+
+type cvatMeta struct {
+    Labels []cvatLabel `xml:"task>labels>label"`
+}
+
+type cvatLabel struct {
+    Name string `xml:"name"`
+}
+
+type cvatImage struct {
+    ID int       `xml:"id,attr"`
+    Name string  `xml:"name,attr"`
+    Width int    `xml:"width,attr"`
+    Height int   `xml:"height,attr"`
+    Tag cvatTag  `xml:"tag"`
+}
+
+type cvatTag struct {
+    Label string  `xml:"label,attr"`
+    Source string `xml:"source,attr"`
+}
+
+// ToCVAT writes images as annotations in "CVAT for images 1.1" format, tagging
+// each image with its query, to be uploaded into a task made of the images folder.
+func ToCVAT(images []LabeledImage, fileName string) error {
+    annotations := cvatAnnotations{Version:"1.1", Images:make([]cvatImage, 0, len(images))}
+    for _, label := range labels(images) {
+        annotations.Meta.Labels = append(annotations.Meta.Labels, cvatLabel{Name:label})
+    }
+    for i, image := range images {
+        annotations.Images = append(annotations.Images, cvatImage{
+            ID: i + 1,
+            Name: image.Path,
+            Width: image.Width,
+            Height: image.Height,
+            Tag: cvatTag{Label:image.Label, Source:"manual"},
+        })
+    }
+
+    data, err := xml.MarshalIndent(annotations, "", "  ")
+    if err != nil { return err }
+    return utils.WriteFileAtomic(fileName, append([]byte(xml.Header), data...))
+}
+
+// ToManifestCSV writes images as a CSV file with path, label, url, width,
+// height and license columns.
+func ToManifestCSV(images []LabeledImage, fileName string) error {
+    f, err := utils.CreateAtomic(fileName)
+    if err != nil { return err }
+
+    writer := csv.NewWriter(f)
+    _ = writer.Write([]string{"path", "label", "url", "width", "height", "license"})
+    for _, image := range images {
+        _ = writer.Write([]string{
+            image.Path, image.Label, image.URL,
+            strconv.Itoa(image.Width), strconv.Itoa(image.Height), image.License,
+        })
+    }
+    writer.Flush()
+
+    if err = writer.Error(); err != nil {
+        _ = f.Abort()
+        return err
+    }
+    return f.Commit()
+}
@@ -0,0 +1,137 @@
+package io
+
+import (
+    "io/ioutil"
+    "path"
+    "regexp"
+    "testing"
+)
+
+// datasetImages are described by the golden outputs of TestDatasetFormats.
+var datasetImages = []LabeledImage{
+    {Path:"collected/a.jpg", Label:"cats", URL:"http://x/a.jpg", Width:64, Height:48, License:"CC BY 4.0"},
+    {Path:"collected/b.png", Label:"dogs", URL:"http://x/b.png?s=1&t=2", Width:32, Height:32},
+    {Path:"collected/c, \"quoted\".jpg", Label:"cats", URL:"http://x/c.jpg", Width:10, Height:20, License:"CC BY 4.0"},
+}
+
+func TestDatasetFormats(t *testing.T) {
+    created := regexp.MustCompile(`"date_created": "[^"]*"`)
+    tests := []struct {
+        format string
+        expected string
+    }{
+        {"coco", `{
+ "info": {
+  "description": "images collected by search queries",
+  "date_created": "DATE"
+ },
+ "licenses": [
+  {
+   "id": 1,
+   "name": "CC BY 4.0",
+   "url": ""
+  }
+ ],
+ "images": [
+  {
+   "id": 1,
+   "file_name": "collected/a.jpg",
+   "width": 64,
+   "height": 48,
+   "license": 1,
+   "coco_url": "http://x/a.jpg"
+  },
+  {
+   "id": 2,
+   "file_name": "collected/b.png",
+   "width": 32,
+   "height": 32,
+   "coco_url": "http://x/b.png?s=1\u0026t=2"
+  },
+  {
+   "id": 3,
+   "file_name": "collected/c, \"quoted\".jpg",
+   "width": 10,
+   "height": 20,
+   "license": 1,
+   "coco_url": "http://x/c.jpg"
+  }
+ ],
+ "categories": [
+  {
+   "id": 1,
+   "name": "cats"
+  },
+  {
+   "id": 2,
+   "name": "dogs"
+  }
+ ],
+ "annotations": []
+}`},
+        {"label-studio", `[
+ {
+  "data": {
+   "image": "/data/local-files/?d=collected/a.jpg",
+   "url": "http://x/a.jpg",
+   "query": "cats"
+  }
+ },
+ {
+  "data": {
+   "image": "/data/local-files/?d=collected/b.png",
+   "url": "http://x/b.png?s=1\u0026t=2",
+   "query": "dogs"
+  }
+ },
+ {
+  "data": {
+   "image": "/data/local-files/?d=collected/c, \"quoted\".jpg",
+   "url": "http://x/c.jpg",
+   "query": "cats"
+  }
+ }
+]`},
+        {"cvat", `<?xml version="1.0" encoding="UTF-8"?>
+<annotations>
+  <version>1.1</version>
+  <meta>
+    <task>
+      <labels>
+        <label>
+          <name>cats</name>
+        </label>
+        <label>
+          <name>dogs</name>
+        </label>
+      </labels>
+    </task>
+  </meta>
+  <image id="1" name="collected/a.jpg" width="64" height="48">
+    <tag label="cats" source="manual"></tag>
+  </image>
+  <image id="2" name="collected/b.png" width="32" height="32">
+    <tag label="dogs" source="manual"></tag>
+  </image>
+  <image id="3" name="collected/c, &#34;quoted&#34;.jpg" width="10" height="20">
+    <tag label="cats" source="manual"></tag>
+  </image>
+</annotations>`},
+        {"manifest", `path,label,url,width,height,license
+collected/a.jpg,cats,http://x/a.jpg,64,48,CC BY 4.0
+collected/b.png,dogs,http://x/b.png?s=1&t=2,32,32,
+"collected/c, ""quoted"".jpg",cats,http://x/c.jpg,10,20,CC BY 4.0
+`},
+    }
+    for _, test := range tests {
+        fileName := path.Join(t.TempDir(), DatasetFormats[test.format].FileName)
+        if err := DatasetFormats[test.format].Export(datasetImages, fileName); err != nil { t.Fatalf("%s: %s", test.format, err) }
+        data, err := ioutil.ReadFile(fileName)
+        if err != nil { t.Fatal(err) }
+
+        written := created.ReplaceAllString(string(data), `"date_created": "DATE"`)
+        if written != test.expected {
+            t.Errorf("%s: expected\n%s\ngot\n%s", test.format, test.expected, written)
+        }
+    }
+}
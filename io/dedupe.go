@@ -0,0 +1,134 @@
+package io
+
+import (
+    "log"
+    "net/url"
+    "sort"
+    "strings"
+)
+
+// trackingParams lists query parameters that don't affect the served image
+// and only differ between otherwise identical links.
+var trackingParams = map[string]bool {
+    "fbclid": true,
+    "gclid": true,
+    "msclkid": true,
+    "mc_cid": true,
+    "mc_eid": true,
+    "igshid": true,
+    "ref": true,
+    "ref_src": true,
+}
+
+// NormalizeURL brings a link into canonical form: lower-cased scheme and host,
+// no default port, no fragment, no tracking parameters and sorted query string.
+func NormalizeURL(link string) (string, error) {
+    parsed, err := url.Parse(strings.TrimSpace(link))
+    if err != nil { return "", err }
+
+    parsed.Scheme = strings.ToLower(parsed.Scheme)
+    host := strings.ToLower(parsed.Host)
+    if (parsed.Scheme == "http" && strings.HasSuffix(host, ":80")) ||
+       (parsed.Scheme == "https" && strings.HasSuffix(host, ":443")) {
+        host = host[:strings.LastIndex(host, ":")]
+    }
+    parsed.Host = host
+    parsed.Fragment = ""
+    parsed.RawFragment = ""
+    if parsed.Path == "" { parsed.Path = "/" }
+
+    values := parsed.Query()
+    for key := range values {
+        lowered := strings.ToLower(key)
+        if strings.HasPrefix(lowered, "utm_") || trackingParams[lowered] {
+            values.Del(key)
+        }
+    }
+    parsed.RawQuery = values.Encode()
+
+    return parsed.String(), nil
+}
+
+// SourcedURL is a unique image link together with every query that produced it.
+type SourcedURL struct {
+    URL string        `json:"url"`
+    Queries []string  `json:"queries"`
+}
+
+// URLSet collects image links, skipping the ones that were already seen
+// after normalization, and keeps the order of first appearance.
+type URLSet struct {
+    index map[string]int
+    items []*SourcedURL
+    skipped int
+}
+
+func NewURLSet() *URLSet {
+    return &URLSet{index:make(map[string]int)}
+}
+
+// Add registers link found by query and reports if the link wasn't seen before.
+// Links that cannot be parsed are compared verbatim.
+func (s *URLSet) Add(link, query string) bool {
+    key, err := NormalizeURL(link)
+    if err != nil { key = link }
+
+    if i, ok := s.index[key]; ok {
+        s.skipped++
+        item := s.items[i]
+        if query != "" && !contains(item.Queries, query) {
+            item.Queries = append(item.Queries, query)
+            sort.Strings(item.Queries)
+        }
+        return false
+    }
+
+    item := &SourcedURL{URL:link}
+    if query != "" { item.Queries = []string{query} }
+    s.index[key] = len(s.items)
+    s.items = append(s.items, item)
+    return true
+}
+
+// URLs returns unique links in order of their first appearance.
+func (s *URLSet) URLs() []string {
+    urls := make([]string, len(s.items))
+    for i, item := range s.items {
+        urls[i] = item.URL
+    }
+    return urls
+}
+
+// Sourced returns unique links with the queries they were found by.
+func (s *URLSet) Sourced() []SourcedURL {
+    sourced := make([]SourcedURL, len(s.items))
+    for i, item := range s.items {
+        sourced[i] = *item
+    }
+    return sourced
+}
+
+// Unique drops the records repeating links of earlier ones. The returned set
+// knows every query each link was found by.
+func Unique(records []ImageRecord) ([]ImageRecord, *URLSet) {
+    links := NewURLSet()
+    unique := make([]ImageRecord, 0, len(records))
+    for _, record := range records {
+        if links.Add(record.ContentURL, record.Query) { unique = append(unique, record) }
+    }
+    log.Printf("loaded %d unique links, %d duplicates skipped", links.Len(), links.Skipped())
+    return unique, links
+}
+
+// Len returns the number of unique links.
+func (s *URLSet) Len() int { return len(s.items) }
+
+// Skipped returns the number of duplicates dropped so far.
+func (s *URLSet) Skipped() int { return s.skipped }
+
+func contains(items []string, value string) bool {
+    for _, item := range items {
+        if item == value { return true }
+    }
+    return false
+}
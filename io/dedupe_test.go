@@ -0,0 +1,83 @@
+package io
+
+import (
+    "reflect"
+    "testing"
+)
+
+func TestNormalizeURL(t *testing.T) {
+    tests := []struct {
+        link string
+        expected string
+    }{
+        {"http://example.com/a.jpg", "http://example.com/a.jpg"},
+        {"HTTP://Example.COM/a.jpg", "http://example.com/a.jpg"},
+        {"http://example.com:80/a.jpg", "http://example.com/a.jpg"},
+        {"https://example.com:443/a.jpg", "https://example.com/a.jpg"},
+        {"https://example.com:8443/a.jpg", "https://example.com:8443/a.jpg"},
+        {"http://example.com/a.jpg#top", "http://example.com/a.jpg"},
+        {"http://example.com", "http://example.com/"},
+        {"  http://example.com/a.jpg  ", "http://example.com/a.jpg"},
+        {"http://example.com/a.jpg?b=2&a=1", "http://example.com/a.jpg?a=1&b=2"},
+        {"http://example.com/a.jpg?utm_source=x&UTM_Medium=y&fbclid=z&id=1", "http://example.com/a.jpg?id=1"},
+        {"http://example.com/A.jpg", "http://example.com/A.jpg"},
+    }
+    for _, test := range tests {
+        normalized, err := NormalizeURL(test.link)
+        if err != nil {
+            t.Errorf("%q: unexpected error: %s", test.link, err)
+            continue
+        }
+        if normalized != test.expected {
+            t.Errorf("%q: expected %q, got %q", test.link, test.expected, normalized)
+        }
+    }
+}
+
+func TestURLSet(t *testing.T) {
+    type found struct { link, query string }
+    tests := []struct {
+        name string
+        added []found
+        urls []string
+        queries [][]string
+        skipped int
+    }{
+        {
+            name: "distinct links",
+            added: []found{{"http://a.com/1.jpg", "cats"}, {"http://a.com/2.jpg", "cats"}},
+            urls: []string{"http://a.com/1.jpg", "http://a.com/2.jpg"},
+            queries: [][]string{{"cats"}, {"cats"}},
+        },
+        {
+            name: "same link by other query",
+            added: []found{{"http://a.com/1.jpg", "dogs"}, {"http://A.com:80/1.jpg#x", "cats"}, {"http://a.com/1.jpg", "dogs"}},
+            urls: []string{"http://a.com/1.jpg"},
+            queries: [][]string{{"cats", "dogs"}},
+            skipped: 2,
+        },
+        {
+            name: "links without query",
+            added: []found{{"http://a.com/1.jpg", ""}, {"http://a.com/1.jpg?utm_source=x", ""}},
+            urls: []string{"http://a.com/1.jpg"},
+            queries: [][]string{nil},
+            skipped: 1,
+        },
+    }
+    for _, test := range tests {
+        set := NewURLSet()
+        for _, item := range test.added { set.Add(item.link, item.query) }
+
+        if !reflect.DeepEqual(set.URLs(), test.urls) {
+            t.Errorf("%s: expected links %v, got %v", test.name, test.urls, set.URLs())
+        }
+        for i, sourced := range set.Sourced() {
+            if !reflect.DeepEqual(sourced.Queries, test.queries[i]) {
+                t.Errorf("%s: expected queries %v of %s, got %v", test.name, test.queries[i], sourced.URL, sourced.Queries)
+            }
+        }
+        if set.Skipped() != test.skipped {
+            t.Errorf("%s: expected %d skipped, got %d", test.name, test.skipped, set.Skipped())
+        }
+    }
+}
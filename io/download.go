@@ -4,6 +4,7 @@ import (
     "bing/utils"
     "fmt"
     "io"
+    "io/ioutil"
     "net"
     "net/http"
     "net/url"
@@ -29,21 +30,54 @@ func NewImageFetcher(timeout time.Duration) *ImageFetcher {
     }}
 }
 
-func (f *ImageFetcher) Fetch(imageLink, outputFile string) (filename string, err error) {
-    response, err := f.Get(imageLink)
+// Fetch downloads imageLink into outputFile with the extension of the link or,
+// if the link has none, of the image format, like "jpeg", when it is known.
+func (f *ImageFetcher) Fetch(imageLink, outputFile, format string) (filename string, err error) {
+    response, err := f.get(imageLink)
     if err != nil { return }
     defer utils.SilentClose(response.Body)
 
-    fileURL, err := url.Parse(imageLink)
+    ext, err := extension(imageLink, format)
     if err != nil { return }
 
-    ext, err := utils.FilenameFromURL(fileURL)
+    outputFile += fmt.Sprintf(".%s", ext)
+    file, err := utils.CreateAtomic(outputFile)
     if err != nil { return }
+    if _, err = io.Copy(file, response.Body); err != nil {
+        _ = file.Abort()
+        return
+    }
+    return outputFile, file.Commit()
+}
 
-    outputFile += fmt.Sprintf(".%s", ext)
-    file := utils.MustCreateFile(outputFile)
-    defer utils.SilentClose(file)
-    if _, err = io.Copy(file, response.Body); err != nil { return }
+// FetchBytes downloads imageLink into memory, returning the image with its
+// extension chosen like Fetch does.
+func (f *ImageFetcher) FetchBytes(imageLink, format string) (data []byte, ext string, err error) {
+    response, err := f.get(imageLink)
+    if err != nil { return }
+    defer utils.SilentClose(response.Body)
 
-    return outputFile, file.Sync()
-}
\ No newline at end of file
+    if ext, err = extension(imageLink, format); err != nil { return }
+    data, err = ioutil.ReadAll(response.Body)
+    return
+}
+
+// get requests imageLink; responses with an error status, like dead links
+// answered with 404 pages, are errors.
+func (f *ImageFetcher) get(imageLink string) (*http.Response, error) {
+    response, err := f.Get(imageLink)
+    if err != nil { return nil, err }
+    if response.StatusCode < 200 || response.StatusCode >= 300 {
+        utils.SilentClose(response.Body)
+        return nil, fmt.Errorf("cannot fetch %s: %s", imageLink, response.Status)
+    }
+    return response, nil
+}
+
+func extension(imageLink, format string) (string, error) {
+    fileURL, err := url.Parse(imageLink)
+    if err != nil { return "", err }
+    ext, err := utils.FilenameFromURL(fileURL)
+    if err != nil && format != "" { ext, err = utils.ExtensionFromFormat(format) }
+    return ext, err
+}
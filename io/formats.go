@@ -0,0 +1,162 @@
+package io
+
+import (
+    "bing/api"
+    "errors"
+    "fmt"
+    "log"
+    "os"
+    "path"
+    "path/filepath"
+    "sort"
+    "strings"
+    "time"
+)
+
+// Output is a destination of search results opened for a run.
+type Output interface {
+    Export(collection *api.ImagesCollection, outputFile string) error
+    Close() error
+}
+
+// Format is a way to save search results and, unless it is export only, to
+// load them back.
+type Format struct {
+    Name string
+    // Extension of the files written in the format, like ".json".
+    Extension string
+    // Open prepares the output writing into outputFolder, compressed with
+    // compression if it is not nil.
+    Open func(outputFolder string, compression *Compression) (Output, error)
+    // Import reads the results back; it is nil for export only formats.
+    Import Importer
+    // Scan, if set, streams the results back one by one instead of Import.
+    Scan Scanner
+}
+
+// Scanner returns the way to stream the results of the format back.
+func (f Format) Scanner() Scanner {
+    if f.Scan != nil { return f.Scan }
+    return ImporterScanner(f.Import)
+}
+
+var formats = make(map[string]Format)
+
+// RegisterFormat makes the format available by its name.
+func RegisterFormat(format Format) {
+    formats[format.Name] = format
+}
+
+// LookupFormat returns the format registered under name.
+func LookupFormat(name string) (Format, error) {
+    format, ok := formats[name]
+    if !ok {
+        return Format{}, fmt.Errorf("unknown format '%s', expected one of: %s",
+            name, strings.Join(FormatNames(), ", "))
+    }
+    return format, nil
+}
+
+// FormatNames lists the registered formats.
+func FormatNames() []string {
+    names := make([]string, 0, len(formats))
+    for name := range formats { names = append(names, name) }
+    sort.Strings(names)
+    return names
+}
+
+// DetectFormat finds the importable format of fileName by its extension or,
+// for a folder, by the extension of the first file found in it, trying the
+// formats in order of their names. Extensions of compressed files are skipped.
+func DetectFormat(fileName string) (Format, error) {
+    found := errors.New("found")
+    var detected Format
+    err := filepath.Walk(fileName, func(path string, info os.FileInfo, err error) error {
+        if err != nil { return err }
+        if info.IsDir() { return nil }
+        for _, name := range FormatNames() {
+            format := formats[name]
+            if format.Import != nil && hasExtension(path, format.Extension) {
+                detected = format
+                return found
+            }
+        }
+        return nil
+    })
+    if err == found { return detected, nil }
+    if err != nil { return Format{}, err }
+    return Format{}, fmt.Errorf("cannot detect format of %s, use one of: %s", fileName, strings.Join(FormatNames(), ", "))
+}
+
+// output adapts an Exporter to the Output interface.
+type output struct {
+    export Exporter
+    close func() error
+}
+
+func (o output) Export(collection *api.ImagesCollection, outputFile string) error {
+    return o.export(collection, outputFile)
+}
+
+func (o output) Close() error {
+    if o.close == nil { return nil }
+    return o.close()
+}
+
+// runFile returns the name of the file collecting the results of a run.
+func runFile(outputFolder, extension string) string {
+    return path.Join(outputFolder, time.Now().Format("results-20060102-150405") + extension)
+}
+
+func init() {
+    RegisterFormat(Format{
+        Name: "json",
+        Extension: ".json",
+        Open: func(_ string, compression *Compression) (Output, error) {
+            return output{export:NewJSONExporter(compression)}, nil
+        },
+        Import: FromJSON,
+    })
+    RegisterFormat(Format{
+        Name: "jsonl",
+        Extension: ".jsonl",
+        Open: func(outputFolder string, compression *Compression) (Output, error) {
+            fileName := runFile(outputFolder, ".jsonl" + compression.Ext())
+            export, closeFunc, err := NewJSONLExporter(fileName, compression)
+            if err != nil { return nil, err }
+            log.Printf("writing query results into file: %s", fileName)
+            return output{export:export, close:closeFunc}, nil
+        },
+        Import: FromJSONL,
+        Scan: ScanJSONLFiles,
+    })
+    RegisterFormat(Format{
+        Name: "csv",
+        Extension: ".csv",
+        Open: func(outputFolder string, compression *Compression) (Output, error) {
+            fileName := runFile(outputFolder, ".csv" + compression.Ext())
+            export, closeFunc, err := NewCSVFileExporter(fileName, DefaultCSVColumns, compression, false)
+            if err != nil { return nil, err }
+            log.Printf("writing query results into file: %s", fileName)
+            return output{export:export, close:closeFunc}, nil
+        },
+        Import: FromCSV,
+    })
+    RegisterFormat(Format{
+        Name: "sqlite",
+        Extension: ".db",
+        Open: func(outputFolder string, compression *Compression) (Output, error) {
+            if compression != nil { return nil, fmt.Errorf("sqlite format cannot be compressed") }
+            return OpenStore(path.Join(outputFolder, StoreFile))
+        },
+        Import: FromSQLite,
+    })
+    RegisterFormat(Format{
+        Name: "parquet",
+        Extension: ".parquet",
+        // Parquet compresses the columns inside the files
+        Open: func(_ string, compression *Compression) (Output, error) {
+            return output{export:NewParquetExporter(compression)}, nil
+        },
+    })
+}
@@ -1,32 +1,111 @@
 package io
 
 import (
+    "bing/api"
     "encoding/json"
-    "io/ioutil"
+    "fmt"
+    "log"
     "os"
     "path/filepath"
     "strings"
 )
 
-type Importer func(string, string) ([]string, error)
+// ImageRecord is an image read from exported search results, together with
+// the query and the offset of the page that found it, and the file it was
+// read from. Formats without pages, like CSV, have zero offsets.
+type ImageRecord struct {
+    api.ImageResult
+    Query string  `json:"query"`
+    Offset int    `json:"offset"`
+    Source string `json:"source,omitempty"`
+}
 
-// FromJSON loads meta information from outputFolder with JSON files.
-func FromJSON(outputFolder, fieldName string) ([]string, error) {
-    queryLinks := make([]string, 0)
+// Importer loads every image record from exported search results: a folder
+// or a single file. Malformed records are reported as errors.
+type Importer func(string) ([]ImageRecord, error)
+
+// Scanner calls fn with every image record read from exported search results,
+// one at a time, so the records don't have to be loaded into memory at once.
+type Scanner func(folder string, fn func(record ImageRecord) error) error
+
+// ImporterScanner adapts importer to the Scanner type.
+func ImporterScanner(importer Importer) Scanner {
+    return func(folder string, fn func(record ImageRecord) error) error {
+        records, err := importer(folder)
+        if err != nil { return err }
+        for _, record := range records {
+            if err = fn(record); err != nil { return err }
+        }
+        return nil
+    }
+}
+
+// FromJSON loads the images from outputFolder with JSON files written by ToJSON.
+func FromJSON(outputFolder string) ([]ImageRecord, error) {
+    collections, sources, err := loadCollections(outputFolder)
+    if err != nil { return nil, err }
+
+    records := make([]ImageRecord, 0)
+    for i, collection := range collections {
+        for j, image := range collection.Values {
+            if image.ContentURL == "" {
+                return nil, fmt.Errorf("%s: image %d has no contentUrl", sources[i], j)
+            }
+            records = append(records, ImageRecord{
+                ImageResult: image,
+                Query: collection.Query,
+                Offset: collection.Offset,
+                Source: sources[i],
+            })
+        }
+    }
+    log.Printf("loaded %d images from %d files", len(records), len(collections))
+    return records, nil
+}
+
+// Collections groups records back into pages: consecutive records of the same
+// file, query and offset make a page.
+func Collections(records []ImageRecord) []*api.ImagesCollection {
+    collections := make([]*api.ImagesCollection, 0)
+    var last *api.ImagesCollection
+    lastSource := ""
+    for _, record := range records {
+        if last == nil || record.Source != lastSource || record.Query != last.Query || record.Offset != last.Offset {
+            last = &api.ImagesCollection{Query:record.Query, Offset:record.Offset}
+            lastSource = record.Source
+            collections = append(collections, last)
+        }
+        last.Values = append(last.Values, record.ImageResult)
+    }
+    return collections
+}
+
+// LoadCollections reads every exported query result from outputFolder.
+func LoadCollections(outputFolder string) ([]*api.ImagesCollection, error) {
+    collections, _, err := loadCollections(outputFolder)
+    return collections, err
+}
+
+// loadCollections reads exported query results with the names of their files.
+func loadCollections(outputFolder string) ([]*api.ImagesCollection, []string, error) {
+    collections := make([]*api.ImagesCollection, 0)
+    sources := make([]string, 0)
     err := filepath.Walk(outputFolder, func(path string, info os.FileInfo, err error) error {
-        if !strings.HasSuffix(path, ".json") { return nil }
-        if data, err := ioutil.ReadFile(path); err != nil {
-            return err
+        if err != nil { return err }
+        if !hasExtension(path, ".json") { return nil }
+        data, err := readFile(path)
+        if err != nil { return err }
+        collection := &api.ImagesCollection{}
+        if strings.HasPrefix(strings.TrimSpace(string(data)), "[") {
+            // files written before the query was stored along with the results
+            err = json.Unmarshal(data, &collection.Values)
         } else {
-            var content []map[string]interface{}
-            err = json.Unmarshal(data, &content)
-            if err != nil { return err }
-            for _, record := range content {
-                url := record[fieldName].(string)
-                queryLinks = append(queryLinks, url)
-            }
+            err = json.Unmarshal(data, collection)
         }
+        if err != nil { return fmt.Errorf("cannot read %s: %s", path, err) }
+        collections = append(collections, collection)
+        sources = append(sources, path)
         return nil
     })
-    return queryLinks, err
-}
\ No newline at end of file
+    return collections, sources, err
+}
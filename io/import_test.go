@@ -0,0 +1,98 @@
+package io
+
+import (
+    "bing/api"
+    "bytes"
+    "io/ioutil"
+    "path"
+    "reflect"
+    "testing"
+)
+
+func TestCollections(t *testing.T) {
+    record := func(source, query string, offset int, link string) ImageRecord {
+        return ImageRecord{ImageResult:api.ImageResult{ContentURL:link}, Query:query, Offset:offset, Source:source}
+    }
+    records := []ImageRecord{
+        record("a.json", "cats", 0, "1"),
+        record("a.json", "cats", 0, "2"),
+        record("b.json", "cats", 2, "3"),
+        record("r.jsonl", "dogs", 0, "4"),
+        record("r.jsonl", "cats", 0, "5"),
+        record("r.jsonl", "cats", 1, "6"),
+    }
+    expected := []struct {
+        query string
+        offset int
+        count int
+    }{
+        {"cats", 0, 2}, {"cats", 2, 1}, {"dogs", 0, 1}, {"cats", 0, 1}, {"cats", 1, 1},
+    }
+
+    collections := Collections(records)
+    if len(collections) != len(expected) { t.Fatalf("expected %d pages, got %d", len(expected), len(collections)) }
+    for i, collection := range collections {
+        if collection.Query != expected[i].query || collection.Offset != expected[i].offset || len(collection.Values) != expected[i].count {
+            t.Errorf("page %d: expected %+v, got %s at %d with %d images",
+                i, expected[i], collection.Query, collection.Offset, len(collection.Values))
+        }
+    }
+}
+
+func TestDetectFormat(t *testing.T) {
+    tests := []struct {
+        files []string
+        expected string
+    }{
+        {[]string{"a.json"}, "json"},
+        {[]string{"a.jsonl.gz"}, "jsonl"},
+        {[]string{"a.csv.zst"}, "csv"},
+        {[]string{"metadata.db"}, "sqlite"},
+        // the first file found decides
+        {[]string{"a.jsonl", "b.json"}, "jsonl"},
+        {[]string{"a.parquet", "notes.txt"}, ""},
+    }
+    for _, test := range tests {
+        folder := t.TempDir()
+        for _, name := range test.files {
+            if err := ioutil.WriteFile(path.Join(folder, name), nil, 0644); err != nil { t.Fatal(err) }
+        }
+        format, err := DetectFormat(folder)
+        if test.expected == "" {
+            if err == nil { t.Errorf("%v: expected an error, got %s", test.files, format.Name) }
+        } else if err != nil || format.Name != test.expected {
+            t.Errorf("%v: expected %s, got %s, %v", test.files, test.expected, format.Name, err)
+        }
+    }
+}
+
+func TestStreamRoundTrip(t *testing.T) {
+    first, second := csvCollection("cats", 2), csvCollection("dogs", 1)
+    second.Offset = 150
+    tests := [][]*api.ImagesCollection{
+        {first},
+        {first, second},
+        {},
+    }
+    for _, collections := range tests {
+        var buffer bytes.Buffer
+        export := NewStreamExporter(&buffer)
+        expected := make([]ImageRecord, 0)
+        for _, collection := range collections {
+            if err := export(collection, "ignored"); err != nil { t.Fatal(err) }
+            for _, image := range collection.Values {
+                expected = append(expected, ImageRecord{ImageResult:image, Query:collection.Query, Offset:collection.Offset})
+            }
+        }
+
+        scanned := make([]ImageRecord, 0)
+        err := ScanJSONL(&buffer, func(record ImageRecord) error {
+            scanned = append(scanned, record)
+            return nil
+        })
+        if err != nil { t.Fatal(err) }
+        if !reflect.DeepEqual(scanned, expected) {
+            t.Errorf("expected %+v, got %+v", expected, scanned)
+        }
+    }
+}
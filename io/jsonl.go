@@ -0,0 +1,90 @@
+package io
+
+import (
+    "bufio"
+    "bytes"
+    "encoding/json"
+    "fmt"
+    "io"
+    "log"
+    "os"
+    "path/filepath"
+)
+
+// NewJSONLExporter returns an Exporter appending each image as a JSON line into
+// a single fileName, compressed with compression and ignoring the output file
+// names of the pages, together with the function flushing the file and putting
+// it in place once the export is over.
+func NewJSONLExporter(fileName string, compression *Compression) (Exporter, func() error, error) {
+    f, err := createFile(fileName, false, compression)
+    if err != nil { return nil, nil, err }
+
+    buffered := bufio.NewWriter(f)
+    closeFunc := func() error {
+        if err := buffered.Flush(); err != nil {
+            _ = f.Abort()
+            return err
+        }
+        return f.Close()
+    }
+    return NewStreamExporter(buffered), closeFunc, nil
+}
+
+// ScanJSONL reads JSON lines from r one by one and calls fn with each record,
+// so the results of large crawls are never loaded into memory at once. Lines
+// that are not image objects with a contentUrl are reported as errors.
+func ScanJSONL(r io.Reader, fn func(record ImageRecord) error) error {
+    scanner := bufio.NewScanner(r)
+    scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+    line := 0
+    for scanner.Scan() {
+        line++
+        data := scanner.Bytes()
+        if len(bytes.TrimSpace(data)) == 0 { continue }
+
+        var record ImageRecord
+        if err := json.Unmarshal(data, &record); err != nil {
+            return fmt.Errorf("line %d: %s", line, err)
+        }
+        if record.ContentURL == "" { return fmt.Errorf("line %d: no contentUrl", line) }
+        if err := fn(record); err != nil { return err }
+    }
+    return scanner.Err()
+}
+
+// FromJSONL loads the images from a JSON lines file, or a folder with such
+// files, written by a JSONL exporter.
+func FromJSONL(outputFolder string) ([]ImageRecord, error) {
+    records := make([]ImageRecord, 0)
+    err := ScanJSONLFiles(outputFolder, func(record ImageRecord) error {
+        records = append(records, record)
+        return nil
+    })
+    if err != nil { return nil, err }
+    return records, nil
+}
+
+// ScanJSONLFiles streams the images from a JSON lines file, or a folder with
+// such files, into fn one by one.
+func ScanJSONLFiles(outputFolder string, fn func(record ImageRecord) error) error {
+    count := 0
+    err := filepath.Walk(outputFolder, func(path string, info os.FileInfo, err error) error {
+        if err != nil { return err }
+        if !hasExtension(path, ".jsonl") { return nil }
+
+        f, err := openFile(path)
+        if err != nil { return err }
+        defer f.Close()
+
+        err = ScanJSONL(f, func(record ImageRecord) error {
+            record.Source = path
+            count++
+            return fn(record)
+        })
+        if err != nil { return fmt.Errorf("cannot read %s: %s", path, err) }
+        return nil
+    })
+    if err != nil { return err }
+    log.Printf("loaded %d images from %s", count, outputFolder)
+    return nil
+}
@@ -0,0 +1,92 @@
+package io
+
+import (
+    "bing/api"
+    "bing/utils"
+
+    "github.com/parquet-go/parquet-go"
+)
+
+// ParquetRow is the schema of Parquet datasets: a single image found by a
+// query, with the outcome of its download when it is known.
+type ParquetRow struct {
+    Query string          `parquet:"query"`
+    Offset int64          `parquet:"offset"`
+    Position int64        `parquet:"position"`
+    ImageID string        `parquet:"image_id"`
+    Name string           `parquet:"name"`
+    ContentURL string     `parquet:"content_url"`
+    HostPageURL string    `parquet:"host_page_url"`
+    WebSearchURL string   `parquet:"web_search_url"`
+    Width int32           `parquet:"width"`
+    Height int32          `parquet:"height"`
+    EncodingFormat string `parquet:"encoding_format"`
+    ContentSize string    `parquet:"content_size"`
+    AccentColor string    `parquet:"accent_color"`
+    Downloaded bool       `parquet:"downloaded"`
+    Filename string       `parquet:"filename,optional"`
+    DownloadError string  `parquet:"download_error,optional"`
+}
+
+// ParquetRows converts the images of a collection into rows without download
+// information.
+func ParquetRows(collection *api.ImagesCollection) []ParquetRow {
+    rows := make([]ParquetRow, 0, len(collection.Values))
+    for i, image := range collection.Values {
+        rows = append(rows, ParquetRow{
+            Query: collection.Query,
+            Offset: int64(collection.Offset),
+            Position: int64(i),
+            ImageID: image.ImageID,
+            Name: image.Name,
+            ContentURL: image.ContentURL,
+            HostPageURL: image.HostPageURL,
+            WebSearchURL: image.WebSearchURL,
+            Width: int32(image.Width),
+            Height: int32(image.Height),
+            EncodingFormat: image.EncodingFormat,
+            ContentSize: image.ContentSize,
+            AccentColor: image.AccentColor,
+        })
+    }
+    return rows
+}
+
+// WriteParquet saves rows into a Parquet file, with the columns compressed by
+// the codec of compression, if it is not nil.
+func WriteParquet(fileName string, rows []ParquetRow, compression *Compression) error {
+    f, err := utils.CreateAtomic(fileName)
+    if err != nil { return err }
+
+    options := make([]parquet.WriterOption, 0)
+    if compression != nil {
+        switch compression.Name {
+        case "gzip": options = append(options, parquet.Compression(&parquet.Gzip))
+        case "zstd": options = append(options, parquet.Compression(&parquet.Zstd))
+        }
+    }
+    writer := parquet.NewGenericWriter[ParquetRow](f, options...)
+    if _, err = writer.Write(rows); err != nil {
+        _ = f.Abort()
+        return err
+    }
+    if err = writer.Close(); err != nil {
+        _ = f.Abort()
+        return err
+    }
+    return f.Commit()
+}
+
+// ToParquet saves the collection into a Parquet file. The files written into
+// the same folder share the schema, so the folder can be read as a dataset.
+func ToParquet(collection *api.ImagesCollection, outputFile string) error {
+    return NewParquetExporter(nil)(collection, outputFile)
+}
+
+// NewParquetExporter returns an Exporter writing Parquet files like ToParquet
+// does, with the columns compressed by compression.
+func NewParquetExporter(compression *Compression) Exporter {
+    return func(collection *api.ImagesCollection, outputFile string) error {
+        return WriteParquet(outputFile + ".parquet", ParquetRows(collection), compression)
+    }
+}
@@ -0,0 +1,39 @@
+package io
+
+import (
+    "path"
+    "reflect"
+    "testing"
+
+    "github.com/parquet-go/parquet-go"
+)
+
+func TestWriteParquet(t *testing.T) {
+    downloaded := ParquetRows(csvCollection("cats", 2))
+    downloaded[0].Downloaded, downloaded[0].Filename = true, "collected/a.jpg"
+    downloaded[1].DownloadError = "cannot fetch: 404 Not Found"
+    tests := []struct {
+        name string
+        rows []ParquetRow
+        compression string
+    }{
+        {"plain", ParquetRows(csvCollection("cats", 3)), ""},
+        {"gzip", ParquetRows(csvCollection("dogs", 2)), "gzip"},
+        {"zstd", ParquetRows(csvCollection("birds", 2)), "zstd"},
+        {"downloads", downloaded, ""},
+        {"empty", []ParquetRow{}, ""},
+    }
+    for _, test := range tests {
+        compression, err := LookupCompression(test.compression)
+        if err != nil { t.Fatal(err) }
+        fileName := path.Join(t.TempDir(), test.name + ".parquet")
+        if err = WriteParquet(fileName, test.rows, compression); err != nil { t.Fatalf("%s: %s", test.name, err) }
+
+        rows, err := parquet.ReadFile[ParquetRow](fileName)
+        if err != nil { t.Fatalf("%s: %s", test.name, err) }
+        if len(rows) == 0 && len(test.rows) == 0 { continue }
+        if !reflect.DeepEqual(rows, test.rows) {
+            t.Errorf("%s: expected %+v, got %+v", test.name, test.rows, rows)
+        }
+    }
+}
@@ -0,0 +1,108 @@
+package io
+
+import (
+    "archive/tar"
+    "bing/utils"
+    "encoding/json"
+    "fmt"
+    "log"
+    "os"
+    "path"
+    "path/filepath"
+    "sync"
+    "time"
+)
+
+// ShardWriter packs images with their JSON metadata into sequentially
+// numbered tar shards, like WebDataset reads them: each sample is a pair of
+// files sharing the key, e.g. 000003_000042.jpg and 000003_000042.json. It is
+// safe to use from several workers at once.
+type ShardWriter struct {
+    Folder string
+    // MaxSize of a shard in bytes; a shard gets at least one sample even if it is larger.
+    MaxSize int64
+
+    mu sync.Mutex
+    file *utils.AtomicFile
+    name string
+    tar *tar.Writer
+    index int
+    size int64
+    count int
+}
+
+// NewShardWriter returns a writer adding shards into folder after the ones
+// already there.
+func NewShardWriter(folder string, maxSize int64) (*ShardWriter, error) {
+    if err := os.MkdirAll(folder, os.ModePerm); err != nil { return nil, err }
+    existing, err := filepath.Glob(path.Join(folder, "shard-*.tar"))
+    if err != nil { return nil, err }
+    last := -1
+    for _, fileName := range existing {
+        var index int
+        if _, err := fmt.Sscanf(path.Base(fileName), "shard-%d.tar", &index); err == nil && index > last {
+            last = index
+        }
+    }
+    return &ShardWriter{Folder:folder, MaxSize:maxSize, index:last}, nil
+}
+
+// Write adds a sample made of the image with extension ext and metadata
+// encoded as JSON, returning the shard file and the sample key.
+func (w *ShardWriter) Write(ext string, image []byte, metadata interface{}) (shard, key string, err error) {
+    meta, err := json.Marshal(metadata)
+    if err != nil { return "", "", err }
+
+    w.mu.Lock()
+    defer w.mu.Unlock()
+
+    sampleSize := int64(len(image) + len(meta) + 3 * 512)
+    if w.tar == nil || (w.count > 0 && w.size + sampleSize > w.MaxSize) {
+        if err = w.next(); err != nil { return "", "", err }
+    }
+
+    key = fmt.Sprintf("%06d_%06d", w.index, w.count)
+    if err = w.add(key + "." + ext, image); err != nil { return "", "", err }
+    if err = w.add(key + ".json", meta); err != nil { return "", "", err }
+    w.size += sampleSize
+    w.count++
+    return w.name, key, nil
+}
+
+func (w *ShardWriter) add(name string, data []byte) error {
+    header := &tar.Header{Name:name, Mode:0644, Size:int64(len(data)), ModTime:time.Now()}
+    if err := w.tar.WriteHeader(header); err != nil { return err }
+    _, err := w.tar.Write(data)
+    return err
+}
+
+// next finishes the current shard and starts the following one.
+func (w *ShardWriter) next() error {
+    if err := w.finish(); err != nil { return err }
+    w.index++
+    fileName := path.Join(w.Folder, fmt.Sprintf("shard-%06d.tar", w.index))
+    file, err := utils.CreateAtomic(fileName)
+    if err != nil { return err }
+    log.Printf("writing images into shard: %s", fileName)
+    w.file, w.name, w.tar, w.size, w.count = file, fileName, tar.NewWriter(file), 0, 0
+    return nil
+}
+
+func (w *ShardWriter) finish() error {
+    if w.tar == nil { return nil }
+    file, tarWriter := w.file, w.tar
+    w.file, w.tar = nil, nil
+    // the shard shows up under its name only when complete
+    if err := tarWriter.Close(); err != nil {
+        _ = file.Abort()
+        return err
+    }
+    return file.Commit()
+}
+
+// Close finishes the last shard.
+func (w *ShardWriter) Close() error {
+    w.mu.Lock()
+    defer w.mu.Unlock()
+    return w.finish()
+}
@@ -0,0 +1,199 @@
+package io
+
+import (
+    "bing/api"
+    "database/sql"
+    "fmt"
+    "log"
+    "os"
+    "path"
+    "time"
+
+    _ "modernc.org/sqlite"
+)
+
+// sqliteSchema creates the tables of the store if they don't exist yet. Every
+// page of results is kept, so repeated crawls of a query add new pages
+// instead of replacing the old ones.
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS queries (
+    id INTEGER PRIMARY KEY,
+    text TEXT NOT NULL UNIQUE
+);
+CREATE TABLE IF NOT EXISTS pages (
+    id INTEGER PRIMARY KEY,
+    query_id INTEGER NOT NULL REFERENCES queries(id),
+    page_offset INTEGER NOT NULL,
+    next_offset INTEGER NOT NULL,
+    fetched_at TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS images (
+    id INTEGER PRIMARY KEY,
+    page_id INTEGER NOT NULL REFERENCES pages(id),
+    position INTEGER NOT NULL,
+    image_id TEXT,
+    name TEXT,
+    content_url TEXT NOT NULL,
+    host_page_url TEXT,
+    web_search_url TEXT,
+    width INTEGER,
+    height INTEGER,
+    encoding_format TEXT,
+    content_size TEXT,
+    accent_color TEXT
+);
+CREATE INDEX IF NOT EXISTS images_content_url ON images(content_url);
+CREATE TABLE IF NOT EXISTS downloads (
+    id INTEGER PRIMARY KEY,
+    url TEXT NOT NULL,
+    filename TEXT,
+    error TEXT,
+    attempted_at TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS downloads_url ON downloads(url);
+`
+
+// StoreFile is the name of the database in the output folder.
+const StoreFile = "metadata.db"
+
+// Store keeps queries, pages of their results, found images and download
+// attempts in a SQLite database, so the state of a crawl can be queried with SQL.
+type Store struct {
+    db *sql.DB
+    fileName string
+}
+
+// OpenStore opens the database in fileName, creating it if needed.
+func OpenStore(fileName string) (*Store, error) {
+    db, err := sql.Open("sqlite", fileName)
+    if err != nil { return nil, err }
+    // a single connection serializes the writers instead of failing them with SQLITE_BUSY
+    db.SetMaxOpenConns(1)
+    if _, err = db.Exec("PRAGMA foreign_keys = ON; PRAGMA journal_mode = WAL;"); err != nil {
+        _ = db.Close()
+        return nil, err
+    }
+    if _, err = db.Exec(sqliteSchema); err != nil {
+        _ = db.Close()
+        return nil, fmt.Errorf("cannot create schema in %s: %s", fileName, err)
+    }
+    log.Printf("using metadata database: %s", fileName)
+    return &Store{db:db, fileName:fileName}, nil
+}
+
+func (s *Store) Close() error {
+    return s.db.Close()
+}
+
+// Export saves a page of results with its query; it is an Exporter ignoring
+// the output file name.
+func (s *Store) Export(collection *api.ImagesCollection, _ string) error {
+    tx, err := s.db.Begin()
+    if err != nil { return err }
+    if err = exportPage(tx, collection); err != nil {
+        _ = tx.Rollback()
+        return err
+    }
+    return tx.Commit()
+}
+
+func exportPage(tx *sql.Tx, collection *api.ImagesCollection) error {
+    _, err := tx.Exec("INSERT INTO queries(text) VALUES (?) ON CONFLICT(text) DO NOTHING", collection.Query)
+    if err != nil { return err }
+    var queryID int64
+    err = tx.QueryRow("SELECT id FROM queries WHERE text = ?", collection.Query).Scan(&queryID)
+    if err != nil { return err }
+
+    page, err := tx.Exec(
+        "INSERT INTO pages(query_id, page_offset, next_offset, fetched_at) VALUES (?, ?, ?, ?)",
+        queryID, collection.Offset, collection.NextOffset, now())
+    if err != nil { return err }
+    pageID, err := page.LastInsertId()
+    if err != nil { return err }
+
+    insert, err := tx.Prepare(`INSERT INTO images(
+        page_id, position, image_id, name, content_url, host_page_url, web_search_url,
+        width, height, encoding_format, content_size, accent_color
+    ) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+    if err != nil { return err }
+    defer insert.Close()
+    for i, image := range collection.Values {
+        _, err = insert.Exec(
+            pageID, i, image.ImageID, image.Name, image.ContentURL, image.HostPageURL, image.WebSearchURL,
+            image.Width, image.Height, image.EncodingFormat, image.ContentSize, image.AccentColor)
+        if err != nil { return err }
+    }
+    return nil
+}
+
+// Records returns the stored images with the queries that found them, in the
+// order they were found.
+func (s *Store) Records() ([]ImageRecord, error) {
+    rows, err := s.db.Query(`SELECT queries.text, pages.page_offset,
+        COALESCE(images.image_id, ''), COALESCE(images.name, ''), images.content_url,
+        COALESCE(images.host_page_url, ''), COALESCE(images.web_search_url, ''),
+        COALESCE(images.width, 0), COALESCE(images.height, 0), COALESCE(images.encoding_format, ''),
+        COALESCE(images.content_size, ''), COALESCE(images.accent_color, '')
+        FROM images
+        JOIN pages ON pages.id = images.page_id
+        JOIN queries ON queries.id = pages.query_id
+        ORDER BY images.id`)
+    if err != nil { return nil, err }
+    defer rows.Close()
+
+    records := make([]ImageRecord, 0)
+    for rows.Next() {
+        record := ImageRecord{Source:s.fileName}
+        err = rows.Scan(&record.Query, &record.Offset,
+            &record.ImageID, &record.Name, &record.ContentURL,
+            &record.HostPageURL, &record.WebSearchURL,
+            &record.Width, &record.Height, &record.EncodingFormat,
+            &record.ContentSize, &record.AccentColor)
+        if err != nil { return nil, err }
+        records = append(records, record)
+    }
+    if err = rows.Err(); err != nil { return nil, err }
+    log.Printf("loaded %d images from %s", len(records), s.fileName)
+    return records, nil
+}
+
+// RecordDownload saves an attempt to download url; errMessage is empty if it
+// succeeded.
+func (s *Store) RecordDownload(url, filename, errMessage string) error {
+    _, err := s.db.Exec(
+        "INSERT INTO downloads(url, filename, error, attempted_at) VALUES (?, ?, ?, ?)",
+        url, nullable(filename), nullable(errMessage), now())
+    return err
+}
+
+// StorePath returns the database file of an output folder, or fileName itself
+// if it is not a folder.
+func StorePath(fileName string) string {
+    if info, err := os.Stat(fileName); err == nil && info.IsDir() { return path.Join(fileName, StoreFile) }
+    return fileName
+}
+
+// OpenExistingStore opens the database in fileName, or in the folder fileName,
+// failing if there is none.
+func OpenExistingStore(fileName string) (*Store, error) {
+    fileName = StorePath(fileName)
+    if _, err := os.Stat(fileName); err != nil { return nil, err }
+    return OpenStore(fileName)
+}
+
+// FromSQLite loads the images from the database written by Store.
+func FromSQLite(fileName string) ([]ImageRecord, error) {
+    store, err := OpenExistingStore(fileName)
+    if err != nil { return nil, err }
+    defer store.Close()
+    return store.Records()
+}
+
+func nullable(value string) interface{} {
+    if value == "" { return nil }
+    return value
+}
+
+func now() string {
+    return time.Now().UTC().Format(time.RFC3339)
+}
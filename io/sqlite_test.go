@@ -0,0 +1,72 @@
+package io
+
+import (
+    "bing/api"
+    "database/sql"
+    "path"
+    "reflect"
+    "testing"
+)
+
+func TestStoreRecords(t *testing.T) {
+    fileName := path.Join(t.TempDir(), StoreFile)
+    store, err := OpenStore(fileName)
+    if err != nil { t.Fatal(err) }
+
+    first, second, other := csvCollection("cats", 2), csvCollection("cats", 1), csvCollection("dogs", 1)
+    second.Offset = 2
+    collections := []*api.ImagesCollection{first, other, second}
+    expected := make([]ImageRecord, 0)
+    for _, collection := range collections {
+        if err = store.Export(collection, "ignored"); err != nil { t.Fatal(err) }
+        for _, image := range collection.Values {
+            expected = append(expected, ImageRecord{ImageResult:image, Query:collection.Query, Offset:collection.Offset, Source:fileName})
+        }
+    }
+    if err = store.Close(); err != nil { t.Fatal(err) }
+
+    records, err := FromSQLite(path.Dir(fileName))
+    if err != nil { t.Fatal(err) }
+    if !reflect.DeepEqual(records, expected) {
+        t.Errorf("expected records %+v, got %+v", expected, records)
+    }
+    if _, err = FromSQLite(path.Join(t.TempDir(), StoreFile)); err == nil {
+        t.Error("expected a missing database to fail")
+    }
+}
+
+func TestStoreDownloads(t *testing.T) {
+    store, err := OpenStore(path.Join(t.TempDir(), StoreFile))
+    if err != nil { t.Fatal(err) }
+    defer store.Close()
+
+    tests := []struct {
+        url string
+        filename string
+        message string
+    }{
+        {"http://x/a.jpg", "images/collected/a.jpg", ""},
+        {"http://x/b.jpg", "", "cannot fetch http://x/b.jpg: 404 Not Found"},
+        {"http://x/b.jpg", "images/collected/b.jpg", ""},
+    }
+    for _, test := range tests {
+        if err = store.RecordDownload(test.url, test.filename, test.message); err != nil { t.Fatal(err) }
+    }
+
+    rows, err := store.db.Query("SELECT url, filename, error FROM downloads ORDER BY id")
+    if err != nil { t.Fatal(err) }
+    defer rows.Close()
+    for _, test := range tests {
+        if !rows.Next() { t.Fatalf("%s: attempt is not recorded", test.url) }
+        var url string
+        var filename, message sql.NullString
+        if err = rows.Scan(&url, &filename, &message); err != nil { t.Fatal(err) }
+        if url != test.url || filename.String != test.filename || message.String != test.message {
+            t.Errorf("expected %+v, got %s %v %v", test, url, filename, message)
+        }
+        if filename.Valid != (test.filename != "") || message.Valid != (test.message != "") {
+            t.Errorf("%s: empty values should be stored as NULL", test.url)
+        }
+    }
+    if rows.Next() { t.Error("unexpected attempts recorded") }
+}
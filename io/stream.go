@@ -0,0 +1,29 @@
+package io
+
+import (
+    "bing/api"
+    "encoding/json"
+    "io"
+    "sync"
+)
+
+// Stdout is the output path meaning standard output instead of a folder.
+const Stdout = "-"
+
+// NewStreamExporter returns an Exporter writing each image of a collection as an
+// ImageRecord JSON line into w, e.g. os.Stdout, ignoring the output file name.
+// ScanJSONL reads such lines back. It is safe to use from several workers at once.
+func NewStreamExporter(w io.Writer) Exporter {
+    var mu sync.Mutex
+    encoder := json.NewEncoder(w)
+    return func(collection *api.ImagesCollection, _ string) error {
+        mu.Lock()
+        defer mu.Unlock()
+        for _, image := range collection.Values {
+            if err := encoder.Encode(ImageRecord{Query:collection.Query, Offset:collection.Offset, ImageResult:image}); err != nil {
+                return err
+            }
+        }
+        return nil
+    }
+}
@@ -0,0 +1,29 @@
+package io
+
+import (
+    "bing/utils"
+    "fmt"
+    "image"
+    _ "image/gif"
+    _ "image/jpeg"
+    _ "image/png"
+    "os"
+
+    _ "golang.org/x/image/bmp"
+    _ "golang.org/x/image/webp"
+)
+
+// VerifyImage checks that fileName exists and can be decoded as a JPEG, PNG,
+// GIF, BMP or WebP image.
+func VerifyImage(fileName string) (image.Config, error) {
+    file, err := os.Open(fileName)
+    if err != nil { return image.Config{}, err }
+    defer utils.SilentClose(file)
+
+    config, _, err := image.DecodeConfig(file)
+    if err != nil { return image.Config{}, fmt.Errorf("%s is not a valid image: %s", fileName, err) }
+    if config.Width == 0 || config.Height == 0 {
+        return config, fmt.Errorf("%s has empty dimensions", fileName)
+    }
+    return config, nil
+}
@@ -0,0 +1,49 @@
+package io
+
+import (
+    "bytes"
+    "image"
+    "image/color"
+    "image/gif"
+    "image/jpeg"
+    "image/png"
+    "io/ioutil"
+    "path"
+    "testing"
+)
+
+func TestVerifyImage(t *testing.T) {
+    img := image.NewPaletted(image.Rect(0, 0, 4, 3), []color.Color{color.Black, color.White})
+    encoded := func(encode func(*bytes.Buffer) error) []byte {
+        var b bytes.Buffer
+        if err := encode(&b); err != nil { t.Fatal(err) }
+        return b.Bytes()
+    }
+
+    tests := []struct {
+        name string
+        data []byte
+        valid bool
+    }{
+        {"a.jpg", encoded(func(b *bytes.Buffer) error { return jpeg.Encode(b, img, nil) }), true},
+        {"a.png", encoded(func(b *bytes.Buffer) error { return png.Encode(b, img) }), true},
+        {"a.gif", encoded(func(b *bytes.Buffer) error { return gif.Encode(b, img, nil) }), true},
+        {"broken.jpg", []byte("<html>not found</html>"), false},
+        {"empty.png", nil, false},
+    }
+    folder := t.TempDir()
+    for _, test := range tests {
+        fileName := path.Join(folder, test.name)
+        if err := ioutil.WriteFile(fileName, test.data, 0644); err != nil { t.Fatal(err) }
+        config, err := VerifyImage(fileName)
+        if test.valid && (err != nil || config.Width != 4 || config.Height != 3) {
+            t.Errorf("%s: expected a valid 4x3 image, got %+v, %v", test.name, config, err)
+        }
+        if !test.valid && err == nil {
+            t.Errorf("%s: expected an error", test.name)
+        }
+    }
+    if _, err := VerifyImage(path.Join(folder, "missing.jpg")); err == nil {
+        t.Errorf("expected an error for a missing file")
+    }
+}
@@ -0,0 +1,90 @@
+package mockbing
+
+import (
+    "bing/api"
+    "crypto/sha1"
+    "encoding/hex"
+    "encoding/json"
+    "fmt"
+    "io/ioutil"
+    "os"
+    "path/filepath"
+    "sort"
+    "strings"
+)
+
+// HostPlaceholder is replaced with the mock server's base URL in the link
+// fields of fixture results (contentUrl, hostPageUrl and webSearchUrl), so
+// fixtures can point to the local image host.
+const HostPlaceholder = "{{host}}"
+
+// Fixtures maps lower-cased search strings to the full list of their results.
+type Fixtures map[string][]api.ImageResult
+
+// LoadFixtures reads every JSON file from folder. The files have the same layout
+// as the ones written by io.ToJSON, so an output folder of a real crawl can be
+// used as is; pages of the same query are concatenated in order of their offsets.
+func LoadFixtures(folder string) (Fixtures, error) {
+    pages := make(map[string][]api.ImagesCollection)
+    err := filepath.Walk(folder, func(path string, info os.FileInfo, err error) error {
+        if err != nil { return err }
+        if info.IsDir() || !strings.HasSuffix(path, ".json") { return nil }
+        data, err := ioutil.ReadFile(path)
+        if err != nil { return err }
+        var collection api.ImagesCollection
+        if err = json.Unmarshal(data, &collection); err != nil {
+            return fmt.Errorf("invalid fixture %s: %s", path, err)
+        }
+        if collection.Query == "" {
+            return fmt.Errorf("fixture without query: %s", path)
+        }
+        key := fixtureKey(collection.Query)
+        pages[key] = append(pages[key], collection)
+        return nil
+    })
+    if err != nil { return nil, err }
+
+    fixtures := make(Fixtures)
+    for key, collections := range pages {
+        sort.SliceStable(collections, func(i, j int) bool { return collections[i].Offset < collections[j].Offset })
+        for _, collection := range collections {
+            fixtures[key] = append(fixtures[key], collection.Values...)
+        }
+    }
+    return fixtures, nil
+}
+
+// Lookup returns results for query, if there are any.
+func (f Fixtures) Lookup(query string) ([]api.ImageResult, bool) {
+    results, ok := f[fixtureKey(query)]
+    return results, ok
+}
+
+// Synthesize generates count results for query with images served by the
+// local image host.
+func Synthesize(query string, count int) []api.ImageResult {
+    digest := sha1.Sum([]byte(query))
+    prefix := hex.EncodeToString(digest[:])[:12]
+    results := make([]api.ImageResult, count)
+    for i := range results {
+        ext, format := "jpg", "jpeg"
+        if i % 2 == 1 { ext, format = "png", "png" }
+        id := fmt.Sprintf("%s%06d", prefix, i)
+        results[i] = api.ImageResult{
+            AccentColor: id[:6],
+            ContentSize: "2048 B",
+            EncodingFormat: format,
+            Height: 48,
+            Width: 64,
+            ImageID: id,
+            Name: fmt.Sprintf("%s #%d", query, i),
+            WebSearchURL: fmt.Sprintf("%s/search?q=%s", HostPlaceholder, id),
+            ContentURL: fmt.Sprintf("%s/images/%s.%s", HostPlaceholder, id, ext),
+        }
+    }
+    return results
+}
+
+func fixtureKey(query string) string {
+    return strings.ToLower(strings.TrimSpace(query))
+}
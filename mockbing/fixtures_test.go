@@ -0,0 +1,64 @@
+package mockbing
+
+import (
+    "bing/api"
+    "encoding/json"
+    "io/ioutil"
+    "path"
+    "testing"
+)
+
+func TestLoadFixtures(t *testing.T) {
+    folder := t.TempDir()
+    pages := map[string]api.ImagesCollection{
+        // crawl output has random names, so the file order differs from the pages one
+        "a.json": {Query:"Cats", Offset:2, Values:Synthesize("second", 1)},
+        "b.json": {Query:"cats", Offset:0, Values:Synthesize("first", 2)},
+        "c.json": {Query:"dogs", Offset:0, Values:Synthesize("dogs", 1)},
+    }
+    for name, page := range pages {
+        data, _ := json.Marshal(page)
+        if err := ioutil.WriteFile(path.Join(folder, name), data, 0644); err != nil { t.Fatal(err) }
+    }
+
+    fixtures, err := LoadFixtures(folder)
+    if err != nil { t.Fatal(err) }
+
+    tests := []struct {
+        query string
+        names []string
+    }{
+        {"cats", []string{"first #0", "first #1", "second #0"}},
+        {" DOGS ", []string{"dogs #0"}},
+        {"birds", nil},
+    }
+    for _, test := range tests {
+        results, ok := fixtures.Lookup(test.query)
+        if ok != (test.names != nil) || len(results) != len(test.names) {
+            t.Errorf("%q: expected %d results, got %d", test.query, len(test.names), len(results))
+            continue
+        }
+        for i, result := range results {
+            if result.Name != test.names[i] {
+                t.Errorf("%q: expected result %d to be %q, got %q", test.query, i, test.names[i], result.Name)
+            }
+        }
+    }
+}
+
+func TestExpandHost(t *testing.T) {
+    result := expandHost(api.ImageResult{
+        Name: HostPlaceholder,
+        ContentURL: HostPlaceholder + "/images/a.jpg",
+        HostPageURL: HostPlaceholder + "/page",
+        WebSearchURL: HostPlaceholder + "/search?q=a",
+    }, "http://localhost:1")
+
+    expected := api.ImageResult{
+        Name: HostPlaceholder,
+        ContentURL: "http://localhost:1/images/a.jpg",
+        HostPageURL: "http://localhost:1/page",
+        WebSearchURL: "http://localhost:1/search?q=a",
+    }
+    if result != expected { t.Errorf("expected %+v, got %+v", expected, result) }
+}
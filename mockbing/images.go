@@ -0,0 +1,47 @@
+package mockbing
+
+import (
+    "crypto/sha1"
+    "image"
+    "image/color"
+    "image/jpeg"
+    "image/png"
+    "net/http"
+    "path"
+    "strings"
+)
+
+// MissingSuffix marks image names the local host responds to with 404, to
+// simulate dead links in search results.
+const MissingSuffix = "-missing"
+
+// serveImage renders a small solid image which color is derived from its name.
+func (s *Server) serveImage(w http.ResponseWriter, r *http.Request) {
+    name := path.Base(r.URL.Path)
+    ext := path.Ext(name)
+    stem := strings.TrimSuffix(name, ext)
+    if strings.HasSuffix(stem, MissingSuffix) {
+        http.NotFound(w, r)
+        return
+    }
+
+    digest := sha1.Sum([]byte(stem))
+    fill := color.RGBA{R:digest[0], G:digest[1], B:digest[2], A:255}
+    img := image.NewRGBA(image.Rect(0, 0, 64, 48))
+    for y := 0; y < 48; y++ {
+        for x := 0; x < 64; x++ {
+            img.Set(x, y, fill)
+        }
+    }
+
+    switch strings.ToLower(ext) {
+    case ".png":
+        w.Header().Set("Content-Type", "image/png")
+        _ = png.Encode(w, img)
+    case ".jpg", ".jpeg":
+        w.Header().Set("Content-Type", "image/jpeg")
+        _ = jpeg.Encode(w, img, nil)
+    default:
+        http.NotFound(w, r)
+    }
+}
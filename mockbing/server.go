@@ -0,0 +1,184 @@
+// Package mockbing implements a local stand-in for Bing Image Search API v7
+// serving results from fixture files, together with a host for the images
+// referenced by these results. It allows to run the client and the crawler
+// end-to-end without a subscription key and network access.
+package mockbing
+
+import (
+    "bing/api"
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+)
+
+// SearchPath is the path of images search endpoint, same as the real one has.
+const SearchPath = "/bing/v7.0/images/search"
+
+// ImagesPath is the prefix of images served by the local host.
+const ImagesPath = "/images/"
+
+const (
+    defaultCount = 35
+    maxCount = 150
+)
+
+// Options configures behaviour of the mock server.
+type Options struct {
+    // Key is an expected subscription key; any key is accepted if empty.
+    Key string
+    // Synthetic is the number of generated results for queries missing in fixtures.
+    Synthetic int
+    // RequestsPerSecond limits search requests rate; exceeding requests get 429.
+    RequestsPerSecond int
+    // FailEvery makes each N-th search request fail with 500.
+    FailEvery int
+    // FailQueries maps search strings to the status code returned for them.
+    FailQueries map[string]int
+}
+
+// Server is an http.Handler serving search results and images.
+type Server struct {
+    Fixtures Fixtures
+    Options Options
+
+    mu sync.Mutex
+    requests int
+    window time.Time
+    inWindow int
+}
+
+func NewServer(fixtures Fixtures, options Options) *Server {
+    if fixtures == nil { fixtures = make(Fixtures) }
+    return &Server{Fixtures:fixtures, Options:options}
+}
+
+// Start launches the server on a random local port; the caller is responsible
+// to close it. Useful in tests.
+func (s *Server) Start() *httptest.Server {
+    return httptest.NewServer(s)
+}
+
+// Endpoint returns the search endpoint URL for the server running at baseURL.
+func Endpoint(baseURL string) string {
+    return strings.TrimSuffix(baseURL, "/") + SearchPath
+}
+
+// Requests returns the number of search requests received so far.
+func (s *Server) Requests() int {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    return s.requests
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+    switch {
+    case r.URL.Path == SearchPath: s.serveSearch(w, r)
+    case strings.HasPrefix(r.URL.Path, ImagesPath): s.serveImage(w, r)
+    default: http.NotFound(w, r)
+    }
+}
+
+func (s *Server) serveSearch(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet {
+        writeError(w, http.StatusMethodNotAllowed, "InvalidRequest", "only GET is supported")
+        return
+    }
+
+    if s.Options.Key != "" && r.Header.Get("Ocp-Apim-Subscription-Key") != s.Options.Key {
+        writeError(w, http.StatusUnauthorized, "401",
+            "Access denied due to invalid subscription key.")
+        return
+    }
+
+    n, throttled := s.register()
+    if throttled {
+        w.Header().Set("Retry-After", "1")
+        writeError(w, http.StatusTooManyRequests, "429", "Rate limit is exceeded.")
+        return
+    }
+    if s.Options.FailEvery > 0 && n % s.Options.FailEvery == 0 {
+        writeError(w, http.StatusInternalServerError, "ServerError", "injected failure")
+        return
+    }
+
+    params := r.URL.Query()
+    query := params.Get("q")
+    if query == "" {
+        writeError(w, http.StatusBadRequest, "InvalidRequest", "parameter q is missing")
+        return
+    }
+    if status, ok := s.Options.FailQueries[query]; ok {
+        writeError(w, status, strconv.Itoa(status), "injected failure")
+        return
+    }
+
+    count := intParam(params.Get("count"), defaultCount)
+    if count <= 0 || count > maxCount { count = maxCount }
+    offset := intParam(params.Get("offset"), 0)
+    if offset < 0 { offset = 0 }
+
+    results, ok := s.Fixtures.Lookup(query)
+    if !ok { results = Synthesize(query, s.Options.Synthetic) }
+
+    page := make([]api.ImageResult, 0)
+    if offset < len(results) {
+        end := offset + count
+        if end > len(results) { end = len(results) }
+        page = append(page, results[offset:end]...)
+    }
+    host := "http://" + r.Host
+    for i := range page {
+        page[i] = expandHost(page[i], host)
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    _ = json.NewEncoder(w).Encode(map[string]interface{}{
+        "_type": "Images",
+        "totalEstimatedMatches": len(results),
+        "nextOffset": offset + len(page),
+        "value": page,
+    })
+}
+
+// register counts the request and reports its number and whether it exceeds
+// the rate limit.
+func (s *Server) register() (int, bool) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    s.requests++
+    if s.Options.RequestsPerSecond <= 0 { return s.requests, false }
+    now := time.Now()
+    if now.Sub(s.window) >= time.Second {
+        s.window = now
+        s.inWindow = 0
+    }
+    s.inWindow++
+    return s.requests, s.inWindow > s.Options.RequestsPerSecond
+}
+
+func expandHost(result api.ImageResult, host string) api.ImageResult {
+    replace := func(s string) string { return strings.Replace(s, HostPlaceholder, host, -1) }
+    result.ContentURL = replace(result.ContentURL)
+    result.WebSearchURL = replace(result.WebSearchURL)
+    result.HostPageURL = replace(result.HostPageURL)
+    return result
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(status)
+    _ = json.NewEncoder(w).Encode(map[string]interface{}{
+        "_type": "ErrorResponse",
+        "errors": []map[string]string{{"code":code, "message":message}},
+    })
+}
+
+func intParam(value string, fallback int) int {
+    n, err := strconv.Atoi(value)
+    if err != nil { return fallback }
+    return n
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+    "bing/cli"
+    "bing/crawler"
+    "bing/io"
+    "bing/utils"
+    "encoding/json"
+    "flag"
+    "fmt"
+    "log"
+    "os"
+    "path"
+    "path/filepath"
+    "sort"
+    "strings"
+)
+
+var exportOptions struct {
+    Format string
+    Output string
+    Columns string
+    Compression string
+    Append bool
+}
+
+func exportFlags(flags *flag.FlagSet, conf *cli.RunConfig) {
+    flags.StringVar(&exportOptions.Format, "format", "csv", "output format: 'csv' or 'parquet'")
+    flags.StringVar(&exportOptions.Output, "o", "export",
+        "path to the output file, without extension unless it ends with compression one, like 'export.csv.gz'")
+    flags.StringVar(&exportOptions.Compression, "compress", "", "compression of the output file: 'gzip' or 'zstd'")
+    flags.StringVar(&exportOptions.Columns, "columns", strings.Join(io.DefaultCSVColumns, ","),
+        "comma-separated list of CSV columns")
+    flags.BoolVar(&exportOptions.Append, "append", false,
+        "append CSV rows to the output file, which must have the same columns, instead of replacing it")
+    flags.StringVar(&conf.ImagesFolder, "images", conf.ImagesFolder,
+        "path to the folder with downloaded images, adds download status to 'parquet' export")
+}
+
+var datasetOptions struct {
+    Format string
+    Output string
+    License string
+}
+
+func datasetFlags(flags *flag.FlagSet, conf *cli.RunConfig) {
+    flags.StringVar(&datasetOptions.Format, "format", "manifest",
+        "dataset format: 'coco', 'label-studio', 'cvat' or 'manifest'")
+    flags.StringVar(&datasetOptions.Output, "o", "",
+        "path to the output file, a file named after the format in the images folder if not set")
+    flags.StringVar(&datasetOptions.License, "license", "", "license of the images, if it is known")
+    flags.StringVar(&io.LabelStudioPrefix, "label-studio-prefix", io.LabelStudioPrefix,
+        "prefix of image paths in Label Studio tasks")
+}
+
+var dedupeOptions struct {
+    Output string
+}
+
+func dedupeFlags(flags *flag.FlagSet, conf *cli.RunConfig) {
+    flags.StringVar(&dedupeOptions.Output, "o", "-", "path to the output JSON file, '-' means stdout")
+}
+
+func runStats(conf *cli.RunConfig, args []string) int {
+    if len(args) == 0 { return usageError(fmt.Errorf("expected at least one folder")) }
+    for _, folder := range args {
+        if _, err := os.Stat(path.Join(folder, crawler.ManifestFile)); err == nil {
+            if err = printDownloadStats(folder); err != nil { return fail(err) }
+        } else if err = printSearchStats(folder); err != nil {
+            return fail(err)
+        }
+    }
+    return cli.ExitOK
+}
+
+func printSearchStats(folder string) error {
+    records, err := loadResults(folder)
+    if err != nil { return err }
+
+    links := io.NewURLSet()
+    images := make(map[string]int)
+    for _, record := range records {
+        images[record.Query]++
+        links.Add(record.ContentURL, record.Query)
+    }
+
+    fmt.Printf("%s: %d pages, %d queries, %d images, %d unique links\n",
+        folder, len(io.Collections(records)), len(images), len(records), links.Len())
+    for _, query := range sortedKeys(images) {
+        fmt.Printf("  %6d  %s\n", images[query], query)
+    }
+    return nil
+}
+
+// loadResults reads search results from folder in the format detected by the
+// extensions of its files.
+func loadResults(folder string) ([]io.ImageRecord, error) {
+    format, err := io.DetectFormat(folder)
+    if err != nil { return nil, err }
+    return format.Import(folder)
+}
+
+func printDownloadStats(folder string) error {
+    collected, err := crawler.LoadManifest(folder)
+    if err != nil { return err }
+
+    failed := 0
+    errors := make(map[string]int)
+    for _, item := range collected {
+        if item.Error != "" {
+            failed++
+            errors[item.Error]++
+        }
+    }
+    fmt.Printf("%s: %d images, %d downloaded, %d failed\n",
+        folder, len(collected), len(collected) - failed, failed)
+    for _, message := range sortedKeys(errors) {
+        fmt.Printf("  %6d  %s\n", errors[message], message)
+    }
+    return nil
+}
+
+func runExport(conf *cli.RunConfig, args []string) int {
+    if len(args) != 1 { return usageError(fmt.Errorf("expected a single metadata folder")) }
+    compression, err := io.LookupCompression(exportOptions.Compression)
+    if err != nil { return usageError(err) }
+    if detected, name := io.DetectCompression(exportOptions.Output); detected != nil {
+        if exportOptions.Compression == "" {
+            compression = detected
+        } else if compression != detected {
+            return usageError(fmt.Errorf("-compress %s conflicts with the extension of %s", exportOptions.Compression, exportOptions.Output))
+        }
+        exportOptions.Output = strings.TrimSuffix(name, "." + exportOptions.Format)
+    }
+
+    switch exportOptions.Format {
+    case "csv":
+    case "parquet": return exportParquet(args[0], conf.ImagesFolder, compression)
+    default: return usageError(fmt.Errorf("unknown export format: %s", exportOptions.Format))
+    }
+
+    records, err := loadResults(args[0])
+    if err != nil { return fail(err) }
+    collections := io.Collections(records)
+
+    fileName := exportOptions.Output + ".csv" + compression.Ext()
+    export, closeFunc, err := io.NewCSVFileExporter(fileName, strings.Split(exportOptions.Columns, ","), compression, exportOptions.Append)
+    if err != nil { return usageError(err) }
+    for _, collection := range collections {
+        if err = export(collection, fileName); err != nil {
+            _ = closeFunc()
+            return fail(err)
+        }
+    }
+    if err = closeFunc(); err != nil { return fail(err) }
+    log.Printf("exported %d pages into %s.%s%s",
+        len(collections), exportOptions.Output, exportOptions.Format, compression.Ext())
+    return cli.ExitOK
+}
+
+// exportParquet converts search results in metadataFolder into a single Parquet
+// file; the images found in the manifest of imagesFolder are marked downloaded.
+// Compression applies to the columns, so the file keeps its extension.
+func exportParquet(metadataFolder, imagesFolder string, compression *io.Compression) int {
+    records, err := loadResults(metadataFolder)
+    if err != nil { return fail(err) }
+    collections := io.Collections(records)
+
+    downloads := make(map[string]crawler.Downloaded)
+    collected, err := crawler.LoadManifest(imagesFolder)
+    if os.IsNotExist(err) {
+        log.Printf("no downloads found in %s, exporting search results only", imagesFolder)
+    } else if err != nil {
+        return fail(err)
+    }
+    for _, item := range collected {
+        if key, err := io.NormalizeURL(item.URL); err == nil { downloads[key] = item }
+    }
+
+    rows := make([]io.ParquetRow, 0)
+    for _, collection := range collections {
+        for _, row := range io.ParquetRows(collection) {
+            key, _ := io.NormalizeURL(row.ContentURL)
+            if item, ok := downloads[key]; ok {
+                row.Downloaded = item.Error == ""
+                row.Filename = item.Filename
+                row.DownloadError = item.Error
+            }
+            rows = append(rows, row)
+        }
+    }
+
+    fileName := exportOptions.Output + ".parquet"
+    if err = io.WriteParquet(fileName, rows, compression); err != nil { return fail(err) }
+    log.Printf("exported %d images from %d pages into %s", len(rows), len(collections), fileName)
+    return cli.ExitOK
+}
+
+func runDataset(conf *cli.RunConfig, args []string) int {
+    folder := conf.ImagesFolder
+    switch len(args) {
+    case 0:
+    case 1: folder = args[0]
+    default: return usageError(fmt.Errorf("expected a single images folder"))
+    }
+    format, ok := io.DatasetFormats[datasetOptions.Format]
+    if !ok { return usageError(fmt.Errorf("unknown dataset format: %s", datasetOptions.Format)) }
+
+    collected, err := crawler.LoadManifest(folder)
+    if err != nil { return fail(err) }
+    images := make([]io.LabeledImage, 0, len(collected))
+    for _, item := range collected {
+        if item.Error != "" || item.Filename == "" { continue }
+        if item.Shard != "" {
+            log.Printf("skipping %s: images in tar shards are not supported", item.URL)
+            continue
+        }
+        image, err := labeledImage(folder, item)
+        if err != nil {
+            log.Printf("skipping %s: %s", item.URL, err)
+            continue
+        }
+        images = append(images, image)
+    }
+
+    fileName := datasetOptions.Output
+    if fileName == "" { fileName = path.Join(folder, format.FileName) }
+    if err = format.Export(images, fileName); err != nil { return fail(err) }
+    log.Printf("described %d of %d images in %s", len(images), len(collected), fileName)
+    return cli.ExitOK
+}
+
+// labeledImage describes a downloaded image relative to the images folder,
+// taking its size from the file.
+func labeledImage(folder string, item crawler.Downloaded) (io.LabeledImage, error) {
+    config, err := io.VerifyImage(crawler.ImagePath(folder, item))
+    if err != nil { return io.LabeledImage{}, err }
+
+    image := io.LabeledImage{
+        Path: crawler.DownloadsFolder + "/" + filepath.Base(item.Filename),
+        URL: item.URL,
+        Width: config.Width,
+        Height: config.Height,
+        License: datasetOptions.License,
+    }
+    if len(item.Queries) > 0 { image.Label = item.Queries[0] }
+    return image, nil
+}
+
+func runDedupe(conf *cli.RunConfig, args []string) int {
+    if len(args) != 1 { return usageError(fmt.Errorf("expected a single metadata folder")) }
+
+    records, err := loadResults(args[0])
+    if err != nil { return fail(err) }
+    _, links := io.Unique(records)
+    data, err := json.MarshalIndent(links.Sourced(), "", " ")
+    if err != nil { return fail(err) }
+
+    if dedupeOptions.Output == "-" {
+        fmt.Println(string(data))
+    } else if err = utils.WriteFileAtomic(dedupeOptions.Output, data); err != nil {
+        return fail(err)
+    }
+    return cli.ExitOK
+}
+
+func runVerify(conf *cli.RunConfig, args []string) int {
+    folder := conf.ImagesFolder
+    switch len(args) {
+    case 0:
+    case 1: folder = args[0]
+    default: return usageError(fmt.Errorf("expected a single images folder"))
+    }
+
+    collected, err := crawler.LoadManifest(folder)
+    if err != nil { return fail(err) }
+
+    valid, broken, missing, sharded := 0, 0, 0, 0
+    for _, item := range collected {
+        if item.Error != "" || item.Filename == "" {
+            missing++
+            continue
+        }
+        if item.Shard != "" {
+            sharded++
+            continue
+        }
+        fileName := crawler.ImagePath(folder, item)
+        if _, err := io.VerifyImage(fileName); err != nil {
+            log.Printf("broken image %s (%s): %s", fileName, item.URL, err)
+            broken++
+        } else {
+            valid++
+        }
+    }
+    fmt.Printf("%s: %d valid, %d broken, %d not downloaded\n", folder, valid, broken, missing)
+    if sharded > 0 { fmt.Printf("  %d images in tar shards are not checked\n", sharded) }
+    if broken > 0 { return cli.ExitFailure }
+    return cli.ExitOK
+}
+
+func sortedKeys(counts map[string]int) []string {
+    keys := make([]string, 0, len(counts))
+    for key := range counts { keys = append(keys, key) }
+    sort.Slice(keys, func(i, j int) bool {
+        if counts[keys[i]] != counts[keys[j]] { return counts[keys[i]] > counts[keys[j]] }
+        return keys[i] < keys[j]
+    })
+    return keys
+}
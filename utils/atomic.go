@@ -0,0 +1,92 @@
+package utils
+
+import (
+    "io/ioutil"
+    "log"
+    "os"
+    "path/filepath"
+    "regexp"
+    "time"
+)
+
+// TempSuffix ends the names of files still being written. Such files left by
+// an interrupted run are removed with RemoveTempFiles.
+const TempSuffix = ".partial"
+
+// TempFileAge is the time after which a temporary file is considered left by
+// an interrupted run rather than being written by a running one.
+const TempFileAge = time.Hour
+
+// tempFilePattern matches the names CreateAtomic gives to temporary files.
+var tempFilePattern = regexp.MustCompile(`^\..+\.[0-9]+` + regexp.QuoteMeta(TempSuffix) + `$`)
+
+// AtomicFile is written into a hidden temporary file next to its final name
+// and appears under that name only when committed, so a crash never leaves a
+// truncated file that looks valid to the later stages.
+type AtomicFile struct {
+    *os.File
+    name string
+}
+
+// CreateAtomic starts writing fileName.
+func CreateAtomic(fileName string) (*AtomicFile, error) {
+    dir, base := filepath.Split(fileName)
+    if dir == "" { dir = "." }
+    file, err := ioutil.TempFile(dir, "." + base + ".*" + TempSuffix)
+    if err != nil { return nil, err }
+    return &AtomicFile{File:file, name:fileName}, nil
+}
+
+// Commit flushes the data onto disk and moves the file under its final name.
+func (f *AtomicFile) Commit() error {
+    if err := f.Chmod(0644); err != nil {
+        _ = f.Abort()
+        return err
+    }
+    if err := f.Sync(); err != nil {
+        _ = f.Abort()
+        return err
+    }
+    if err := f.Close(); err != nil {
+        _ = os.Remove(f.Name())
+        return err
+    }
+    return os.Rename(f.Name(), f.name)
+}
+
+// Abort drops the written data, leaving the file under the final name as it was.
+func (f *AtomicFile) Abort() error {
+    _ = f.Close()
+    return os.Remove(f.Name())
+}
+
+// WriteFileAtomic writes data into fileName atomically.
+func WriteFileAtomic(fileName string, data []byte) error {
+    f, err := CreateAtomic(fileName)
+    if err != nil { return err }
+    if _, err = f.Write(data); err != nil {
+        _ = f.Abort()
+        return err
+    }
+    return f.Commit()
+}
+
+// RemoveTempFiles deletes the temporary files left in folder by interrupted
+// runs. Files modified within TempFileAge may be written by a running process
+// and are kept; subfolders are not searched, and a missing folder has nothing
+// to clean.
+func RemoveTempFiles(folder string) error {
+    entries, err := ioutil.ReadDir(folder)
+    if os.IsNotExist(err) { return nil }
+    if err != nil { return err }
+
+    removed := 0
+    for _, entry := range entries {
+        if entry.IsDir() || !tempFilePattern.MatchString(entry.Name()) { continue }
+        if time.Since(entry.ModTime()) < TempFileAge { continue }
+        if err = os.Remove(filepath.Join(folder, entry.Name())); err != nil { return err }
+        removed++
+    }
+    if removed > 0 { log.Printf("removed %d unfinished files from %s", removed, folder) }
+    return nil
+}
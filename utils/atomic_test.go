@@ -0,0 +1,72 @@
+package utils
+
+import (
+    "io/ioutil"
+    "os"
+    "path/filepath"
+    "testing"
+    "time"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+    folder := t.TempDir()
+    fileName := filepath.Join(folder, "a.json")
+    for _, content := range []string{"first", "second"} {
+        if err := WriteFileAtomic(fileName, []byte(content)); err != nil { t.Fatal(err) }
+        data, err := ioutil.ReadFile(fileName)
+        if err != nil { t.Fatal(err) }
+        if string(data) != content { t.Errorf("expected %q, got %q", content, data) }
+    }
+
+    entries, err := ioutil.ReadDir(folder)
+    if err != nil { t.Fatal(err) }
+    if len(entries) != 1 { t.Errorf("expected only the written file, got %d files", len(entries)) }
+}
+
+func TestAbortAtomic(t *testing.T) {
+    fileName := filepath.Join(t.TempDir(), "a.json")
+    if err := WriteFileAtomic(fileName, []byte("kept")); err != nil { t.Fatal(err) }
+    f, err := CreateAtomic(fileName)
+    if err != nil { t.Fatal(err) }
+    if _, err = f.Write([]byte("dropped")); err != nil { t.Fatal(err) }
+    if err = f.Abort(); err != nil { t.Fatal(err) }
+
+    data, err := ioutil.ReadFile(fileName)
+    if err != nil { t.Fatal(err) }
+    if string(data) != "kept" { t.Errorf("expected the file to be kept, got %q", data) }
+    if _, err = os.Stat(f.Name()); !os.IsNotExist(err) { t.Errorf("temporary file %s is left", f.Name()) }
+}
+
+func TestRemoveTempFiles(t *testing.T) {
+    old := time.Now().Add(-2 * TempFileAge)
+    tests := []struct {
+        name string
+        modified time.Time
+        removed bool
+    }{
+        {".results.jsonl.123456" + TempSuffix, old, true},
+        {".a.jpg.42" + TempSuffix, old, true},
+        {".shard-000001.tar.7" + TempSuffix, time.Now(), false},
+        {"notes" + TempSuffix, old, false},
+        {".notes" + TempSuffix, old, false},
+        {".a.jpg.x1" + TempSuffix, old, false},
+        {"a.jpg", old, false},
+        {filepath.Join("sub", ".a.jpg.42" + TempSuffix), old, false},
+    }
+    folder := t.TempDir()
+    if err := os.Mkdir(filepath.Join(folder, "sub"), 0755); err != nil { t.Fatal(err) }
+    for _, test := range tests {
+        fileName := filepath.Join(folder, test.name)
+        if err := ioutil.WriteFile(fileName, nil, 0644); err != nil { t.Fatal(err) }
+        if err := os.Chtimes(fileName, test.modified, test.modified); err != nil { t.Fatal(err) }
+    }
+
+    if err := RemoveTempFiles(folder); err != nil { t.Fatal(err) }
+    if err := RemoveTempFiles(filepath.Join(folder, "missing")); err != nil { t.Errorf("missing folder: %s", err) }
+    for _, test := range tests {
+        _, err := os.Stat(filepath.Join(folder, test.name))
+        if removed := os.IsNotExist(err); removed != test.removed {
+            t.Errorf("%s: expected removed to be %v", test.name, test.removed)
+        }
+    }
+}
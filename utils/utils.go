@@ -43,10 +43,18 @@ func FilenameFromURL(fileURL *url.URL) (string, error) {
     return normalize(path.Ext(fileName))
 }
 
+// ExtensionFromFormat returns the file extension for image format, like "jpeg".
+func ExtensionFromFormat(format string) (string, error) {
+    return normalize("." + format)
+}
+
 func normalize(extension string) (string, error) {
     patterns := map[string]string {
         "jpg": "\\.(jpeg|JPEG|jpg|JPG).*$",
         "png": "\\.(png|PNG).*$",
+        "gif": "\\.(gif|GIF).*$",
+        "webp": "\\.(webp|WEBP).*$",
+        "bmp": "\\.(bmp|BMP).*$",
     }
     for imageExt, regex := range patterns {
         matched, _ := regexp.MatchString(regex, extension)
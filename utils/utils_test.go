@@ -0,0 +1,37 @@
+package utils
+
+import (
+    "net/url"
+    "testing"
+)
+
+func TestExtensions(t *testing.T) {
+    tests := []struct {
+        link string
+        format string
+        expected string
+    }{
+        {"http://x/a.jpg", "", "jpg"},
+        {"http://x/a.JPEG", "", "jpg"},
+        {"http://x/a.png", "", "png"},
+        {"http://x/a.gif", "", "gif"},
+        {"http://x/a.webp", "", "webp"},
+        {"http://x/a.BMP", "", "bmp"},
+        {"http://x/image", "jpeg", "jpg"},
+        {"http://x/image", "gif", "gif"},
+        {"http://x/image", "webp", "webp"},
+        {"http://x/image", "bmp", "bmp"},
+        {"http://x/image", "svg", ""},
+        {"http://x/a.tiff", "", ""},
+    }
+    for _, test := range tests {
+        link, _ := url.Parse(test.link)
+        ext, err := FilenameFromURL(link)
+        if err != nil && test.format != "" { ext, err = ExtensionFromFormat(test.format) }
+        if test.expected == "" {
+            if err == nil { t.Errorf("%s %s: expected an error, got %s", test.link, test.format, ext) }
+        } else if err != nil || ext != test.expected {
+            t.Errorf("%s %s: expected %s, got %s, %v", test.link, test.format, test.expected, ext, err)
+        }
+    }
+}